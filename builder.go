@@ -0,0 +1,78 @@
+package trie
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrUnsortedKey = errors.New("key is not greater than the previous key")
+
+// TrieBuilder builds a trie from keys added in increasing order, such as a sorted word list.
+// Insert walks down from the root for every key, but since each key shares its longest common prefix with the one
+// before it, the builder keeps the previous key's path and only backtracks to that prefix before appending the rest.
+// New nodes always sort after their siblings, so they are appended rather than binary searched into place.
+type TrieBuilder[T any] struct {
+	trie *Trie[T]
+	// path holds the nodes from the root to the previous key's node
+	path []*Node[T]
+	prev string
+	// started is set once a key is added, since the empty key can't be told apart from no previous key
+	started bool
+}
+
+func NewTrieBuilder[T any]() *TrieBuilder[T] {
+	trie := NewTrie[T]()
+	return &TrieBuilder[T]{
+		trie: trie,
+		path: []*Node[T]{trie.Root},
+	}
+}
+
+// Add adds key with value. Keys must be added in strictly increasing order: a key sorting before the previous one
+// returns ErrUnsortedKey and a repeated key returns ErrAlreadyExists, leaving the builder as it was.
+// Like Insert, it rejects keys containing the NUL rune with ErrInvalidRune.
+func (b *TrieBuilder[T]) Add(key string, value T) error {
+	if strings.IndexByte(key, 0) >= 0 {
+		return keyError(key, ErrInvalidRune)
+	}
+	if b.started {
+		// strings compare by bytes, which for UTF-8 is the same as comparing runes like the trie does
+		if key == b.prev {
+			return keyError(key, ErrAlreadyExists)
+		}
+		if key < b.prev {
+			return keyError(key, ErrUnsortedKey)
+		}
+	}
+	common := 0
+	for common < len(key) && common < len(b.prev) && key[common] == b.prev[common] {
+		common++
+	}
+	// back up to the start of a rune the two keys may only share some bytes of
+	for common > 0 && !utf8.RuneStart(key[common]) {
+		common--
+	}
+	b.path = b.path[:utf8.RuneCountInString(key[:common])+1]
+	node := b.path[len(b.path)-1]
+	for _, r := range key[common:] {
+		next := &Node[T]{KeyRune: r, Children: []*Node[T]{}}
+		insertChild(node, len(node.Children), next)
+		b.trie.nodes++
+		b.path = append(b.path, next)
+		node = next
+	}
+	node.IsEnd = true
+	node.Value = value
+	b.trie.keys++
+	b.trie.seq++
+	node.seq = b.trie.seq
+	b.prev = key
+	b.started = true
+	return nil
+}
+
+// Build returns the trie holding the added keys. The builder must not be used afterwards.
+func (b *TrieBuilder[T]) Build() *Trie[T] {
+	return b.trie
+}
@@ -0,0 +1,69 @@
+package trie
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieBuilder(t *testing.T) {
+	t.Run("builds the same trie as Insert", func(t *testing.T) {
+		keys := []string{"", "a", "ab", "abc", "abd", "b", "ba", "café", "cafés", "cat"}
+		builder := NewTrieBuilder[int]()
+		want := NewTrie[int]()
+		for i, key := range keys {
+			assert.Nil(t, builder.Add(key, i))
+			want.Insert(key, i)
+		}
+		trie := builder.Build()
+		assert.Equal(t, keys, trie.GetAll())
+		assert.Equal(t, want.ToMap(), trie.ToMap())
+		assert.Equal(t, want.NodeCount(), trie.NodeCount())
+		assert.Nil(t, trie.Validate())
+
+		// the built trie takes later inserts like any other
+		assert.Nil(t, trie.Insert("aa", 10))
+		assert.Equal(t, []string{"a", "aa", "ab", "abc", "abd"}, trie.PrefixSearch("a"))
+	})
+	t.Run("keys out of order", func(t *testing.T) {
+		builder := NewTrieBuilder[int]()
+		assert.Nil(t, builder.Add("abc", 1))
+		assert.ErrorIs(t, builder.Add("ab", 2), ErrUnsortedKey)
+		assert.ErrorIs(t, builder.Add("abb", 2), ErrUnsortedKey)
+		assert.ErrorIs(t, builder.Add("", 2), ErrUnsortedKey)
+		assert.Equal(t, &KeyError{Key: "abc", Err: ErrAlreadyExists}, builder.Add("abc", 2))
+		// a rejected key leaves the builder able to continue from the last added key
+		assert.Nil(t, builder.Add("abd", 3))
+		assert.Equal(t, []string{"abc", "abd"}, builder.Build().GetAll())
+	})
+	t.Run("NUL rune rejected", func(t *testing.T) {
+		builder := NewTrieBuilder[int]()
+		assert.ErrorIs(t, builder.Add("a\x00", 1), ErrInvalidRune)
+		assert.Nil(t, builder.Add("a", 1))
+		assert.Nil(t, builder.Build().Validate())
+	})
+}
+
+func BenchmarkTrieBuilder(b *testing.B) {
+	words := benchmarkWords(10000)
+	slices.Sort(words)
+
+	b.Run("builder", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			builder := NewTrieBuilder[int]()
+			for j, word := range words {
+				builder.Add(word, j)
+			}
+			builder.Build()
+		}
+	})
+	b.Run("insert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie := NewTrie[int]()
+			for j, word := range words {
+				trie.Insert(word, j)
+			}
+		}
+	})
+}
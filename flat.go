@@ -0,0 +1,91 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidFlatTrie = errors.New("invalid flattened trie")
+
+// FlatNode is a node of a trie flattened by Flatten, which references its children by index rather than by pointer.
+// Nodes are laid out breadth first from the root at index 0, so the children of a node are the NumChildren nodes
+// starting at FirstChild.
+type FlatNode[T any] struct {
+	KeyRune     rune
+	IsEnd       bool
+	SoftDeleted bool
+	Value       T
+	Seq         uint64
+	FirstChild  int
+	NumChildren int
+}
+
+// Flatten returns the nodes of the trie as a slice of FlatNode, for storage without pointers, see InflateTrie.
+func (t *Trie[T]) Flatten() ([]FlatNode[T], error) {
+	flat := []FlatNode[T]{}
+	queue := []*Node[T]{t.Root}
+	// children are appended to the queue in the same order they are numbered, so the indices line up
+	for i := 0; i < len(queue); i++ {
+		node := queue[i]
+		for _, child := range node.Children {
+			if child == nil {
+				return nil, fmt.Errorf("%w: nil child below node %d", ErrInvalidFlatTrie, i)
+			}
+		}
+		flat = append(flat, FlatNode[T]{
+			KeyRune:     node.KeyRune,
+			IsEnd:       node.IsEnd,
+			SoftDeleted: node.softDeleted,
+			Value:       node.Value,
+			Seq:         node.seq,
+			FirstChild:  len(queue),
+			NumChildren: len(node.Children),
+		})
+		queue = append(queue, node.Children...)
+	}
+	return flat, nil
+}
+
+// InflateTrie rebuilds the trie flattened into nodes by Flatten.
+// It returns ErrInvalidFlatTrie if the nodes don't form a trie in the layout Flatten produces.
+func InflateTrie[T any](nodes []FlatNode[T]) (*Trie[T], error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: no root node", ErrInvalidFlatTrie)
+	}
+	t := NewTrie[T]()
+	inflated := make([]*Node[T], len(nodes))
+	inflated[0] = t.Root
+	// the next node expected to be claimed as a child, which keeps every node reachable exactly once
+	next := 1
+	for i, flat := range nodes {
+		node := inflated[i]
+		if node == nil {
+			return nil, fmt.Errorf("%w: node %d is not a child of any node", ErrInvalidFlatTrie, i)
+		}
+		if flat.FirstChild != next || flat.NumChildren < 0 || flat.FirstChild+flat.NumChildren > len(nodes) {
+			return nil, fmt.Errorf("%w: node %d has children out of order or range", ErrInvalidFlatTrie, i)
+		}
+		if flat.IsEnd && flat.SoftDeleted {
+			return nil, fmt.Errorf("%w: node %d is both a key and soft deleted", ErrInvalidFlatTrie, i)
+		}
+		next += flat.NumChildren
+		node.Value = flat.Value
+		node.IsEnd = flat.IsEnd
+		node.softDeleted = flat.SoftDeleted
+		node.seq = flat.Seq
+		t.seq = max(t.seq, flat.Seq)
+		node.Children = make([]*Node[T], flat.NumChildren)
+		for j := range node.Children {
+			c := flat.FirstChild + j
+			if j > 0 && nodes[c].KeyRune <= nodes[c-1].KeyRune {
+				return nil, fmt.Errorf("%w: children of node %d are not sorted", ErrInvalidFlatTrie, i)
+			}
+			inflated[c] = &Node[T]{KeyRune: nodes[c].KeyRune}
+			node.Children[j] = inflated[c]
+		}
+		indexChildren(node)
+	}
+	t.nodes = len(nodes) - 1
+	t.keys = keyCount(t.Root)
+	return t, nil
+}
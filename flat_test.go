@@ -0,0 +1,78 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieFlatten(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		trie := newFixtureTrie()
+		trie.Insert("", "root")
+		flat, err := trie.Flatten()
+		assert.Nil(t, err)
+		assert.Equal(t, trie.NodeCount()+1, len(flat))
+
+		inflated, err := InflateTrie(flat)
+		assert.Nil(t, err)
+		assert.Equal(t, trie, inflated)
+		assert.Equal(t, trie.ToMap(), inflated.ToMap())
+
+		// inserts carry on after the highest sequence number
+		inflated.Insert("dog", "")
+		seq, _ := inflated.Sequence("dog")
+		last, _ := trie.Sequence("")
+		assert.Greater(t, seq, last)
+	})
+	t.Run("round trip with a wide node", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for r := rune(0x4E00); r < 0x4E00+childMapThreshold*2; r++ {
+			trie.Insert(string(r)+"x", int(r))
+		}
+		flat, _ := trie.Flatten()
+		inflated, err := InflateTrie(flat)
+		assert.Nil(t, err)
+		assert.Equal(t, trie, inflated)
+	})
+	t.Run("round trip keeps soft deleted keys", func(t *testing.T) {
+		trie := newTrieOfKeys("ab", "abc")
+		assert.Nil(t, trie.SoftDelete("abc"))
+		flat, _ := trie.Flatten()
+		inflated, err := InflateTrie(flat)
+		assert.Nil(t, err)
+		assert.Equal(t, trie, inflated)
+		assert.Nil(t, inflated.Undelete("abc"))
+		assert.Equal(t, []string{"ab", "abc"}, inflated.GetAll())
+	})
+	t.Run("empty trie", func(t *testing.T) {
+		flat, err := NewTrie[int]().Flatten()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(flat))
+		inflated, err := InflateTrie(flat)
+		assert.Nil(t, err)
+		assert.True(t, inflated.IsEmpty())
+	})
+	t.Run("invalid nodes", func(t *testing.T) {
+		_, err := InflateTrie([]FlatNode[int]{})
+		assert.ErrorIs(t, err, ErrInvalidFlatTrie)
+		_, err = InflateTrie([]FlatNode[int]{{IsEnd: true, SoftDeleted: true, FirstChild: 1}})
+		assert.ErrorIs(t, err, ErrInvalidFlatTrie)
+
+		flat, _ := newFixtureTrie().Flatten()
+		outOfRange := append([]FlatNode[string]{}, flat...)
+		outOfRange[1].NumChildren = len(flat)
+		_, err = InflateTrie(outOfRange)
+		assert.ErrorIs(t, err, ErrInvalidFlatTrie)
+
+		cycle := append([]FlatNode[string]{}, flat...)
+		cycle[0].FirstChild = 0
+		_, err = InflateTrie(cycle)
+		assert.ErrorIs(t, err, ErrInvalidFlatTrie)
+
+		unsorted := append([]FlatNode[string]{}, flat...)
+		unsorted[1], unsorted[2] = unsorted[2], unsorted[1]
+		_, err = InflateTrie(unsorted)
+		assert.ErrorIs(t, err, ErrInvalidFlatTrie)
+	})
+}
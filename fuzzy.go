@@ -0,0 +1,150 @@
+package trie
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// FuzzySearch returns every key within maxDistance edits of query, in lexicographic order.
+// Edits are insertions, deletions and substitutions of single runes, counted as the Levenshtein distance.
+func (t *Trie[T]) FuzzySearch(query string, maxDistance int) []string {
+	keys := []string{}
+	t.FuzzyWalk(query, maxDistance, func(key string, distance int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// FuzzyWalk calls fn for every key within maxDistance edits of query along with its distance,
+// in lexicographic order, without collecting them. The walk stops when fn returns false.
+// Distances are computed one row of the edit distance table per node, shared by every key below it,
+// and subtrees are skipped once every entry of the row is above maxDistance, since no key below can get closer.
+func (t *Trie[T]) FuzzyWalk(query string, maxDistance int, fn func(key string, distance int) bool) {
+	runes := t.preparePrefix(query)
+	row := firstFuzzyRow(runes)
+	if t.Root.IsEnd && row[len(runes)] <= maxDistance && !fn("", row[len(runes)]) {
+		return
+	}
+	fuzzyWalk(t.Root, runes, row, &maxDistance, []rune{}, fn)
+}
+
+// firstFuzzyRow returns the row of the edit distance table for the empty key, where
+// row[j] is the distance between the key so far and the first j runes of query
+func firstFuzzyRow(query []rune) []int {
+	row := make([]int, len(query)+1)
+	for j := range row {
+		row[j] = j
+	}
+	return row
+}
+
+// fuzzyWalk calls fn for the matching keys below node, whose row of the edit distance table is row.
+// It returns false once fn has. fn may lower maxDistance to prune the rest of the walk further.
+func fuzzyWalk[T any](node *Node[T], query []rune, row []int, maxDistance *int, keys []rune, fn func(string, int) bool) bool {
+	for _, child := range node.Children {
+		next := make([]int, len(row))
+		next[0] = row[0] + 1
+		closest := next[0]
+		for j := 1; j < len(row); j++ {
+			substitution := row[j-1]
+			if query[j-1] != child.KeyRune {
+				substitution++
+			}
+			next[j] = min(row[j]+1, next[j-1]+1, substitution)
+			closest = min(closest, next[j])
+		}
+		if closest > *maxDistance {
+			continue
+		}
+		keys := append(keys, child.KeyRune)
+		if distance := next[len(query)]; child.IsEnd && distance <= *maxDistance && !fn(string(keys), distance) {
+			return false
+		}
+		if !fuzzyWalk(child, query, next, maxDistance, keys, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeyDistance is a key along with its edit distance to a query.
+type KeyDistance struct {
+	Key      string
+	Distance int
+}
+
+// NearestKeys returns up to limit keys closest to query by edit distance, as in FuzzySearch,
+// ordered by distance and then lexicographically.
+// Once limit keys are found, subtrees are only searched for keys closer than the furthest of them.
+func (t *Trie[T]) NearestKeys(query string, limit int) []KeyDistance {
+	nearest := []KeyDistance{}
+	if limit <= 0 {
+		return nearest
+	}
+	add := func(key string, distance int) {
+		// keys come in lexicographic order, so a key goes after any at the same distance
+		i, _ := slices.BinarySearchFunc(nearest, distance+1, func(k KeyDistance, distance int) int {
+			return cmp.Compare(k.Distance, distance)
+		})
+		nearest = slices.Insert(nearest, i, KeyDistance{Key: key, Distance: distance})
+		if len(nearest) > limit {
+			nearest = nearest[:limit]
+		}
+	}
+
+	runes := t.preparePrefix(query)
+	row := firstFuzzyRow(runes)
+	if t.Root.IsEnd {
+		add("", row[len(runes)])
+	}
+	maxDistance := math.MaxInt
+	if len(nearest) == limit {
+		maxDistance = nearest[limit-1].Distance - 1
+	}
+	fuzzyWalk(t.Root, runes, row, &maxDistance, []rune{}, func(key string, distance int) bool {
+		add(key, distance)
+		if len(nearest) == limit {
+			maxDistance = nearest[limit-1].Distance - 1
+		}
+		return true
+	})
+	return nearest
+}
+
+// HammingSearch returns, in lexicographic order, every key with as many runes as query which differs from it
+// in at most maxSubs positions. Unlike FuzzySearch no runes are inserted or deleted, so only the nodes
+// at most maxSubs substitutions away from query's path are visited.
+func (t *Trie[T]) HammingSearch(query string, maxSubs int) []string {
+	if maxSubs < 0 {
+		return []string{}
+	}
+	return hammingSearch(t.Root, t.preparePrefix(query), maxSubs, []rune{}, []string{})
+}
+
+// hammingSearch appends the keys below node matching the rest of query with at most subs substitutions
+func hammingSearch[T any](node *Node[T], query []rune, subs int, keys []rune, matches []string) []string {
+	if len(keys) == len(query) {
+		if node.IsEnd {
+			matches = append(matches, string(keys))
+		}
+		return matches
+	}
+	r := query[len(keys)]
+	if subs == 0 {
+		// no substitutions left, so only the query's own rune can follow
+		if next := child(node, r); next != nil {
+			matches = hammingSearch(next, query, 0, append(keys, r), matches)
+		}
+		return matches
+	}
+	for _, child := range node.Children {
+		left := subs
+		if child.KeyRune != r {
+			left--
+		}
+		matches = hammingSearch(child, query, left, append(keys, child.KeyRune), matches)
+	}
+	return matches
+}
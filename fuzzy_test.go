@@ -0,0 +1,102 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieFuzzySearch(t *testing.T) {
+	trie := NewTrie[int]()
+	for _, key := range []string{"", "a", "cat", "cart", "cast", "coat", "dog", "act", "café"} {
+		trie.Insert(key, 0)
+	}
+
+	t.Run("distances", func(t *testing.T) {
+		got := map[string]int{}
+		trie.FuzzyWalk("cat", 1, func(key string, distance int) bool {
+			got[key] = distance
+			return true
+		})
+		assert.Equal(t, map[string]int{"cat": 0, "cart": 1, "cast": 1, "coat": 1}, got)
+	})
+	t.Run("search", func(t *testing.T) {
+		assert.Equal(t, []string{"cat"}, trie.FuzzySearch("cat", 0))
+		assert.Equal(t, []string{"a", "act", "café", "cart", "cast", "cat", "coat"}, trie.FuzzySearch("cat", 2))
+		assert.Equal(t, []string{"café"}, trie.FuzzySearch("cafe", 1))
+		assert.Equal(t, []string{"", "a"}, trie.FuzzySearch("", 1))
+		assert.Equal(t, []string{}, trie.FuzzySearch("zebra", 2))
+	})
+	t.Run("early stop", func(t *testing.T) {
+		got := []string{}
+		trie.FuzzyWalk("cat", 2, func(key string, distance int) bool {
+			got = append(got, key)
+			return len(got) < 3
+		})
+		assert.Equal(t, []string{"a", "act", "café"}, got)
+	})
+}
+
+func TestTrieNearestKeys(t *testing.T) {
+	trie := NewTrie[int]()
+	for _, key := range []string{"a", "cat", "cart", "cast", "coat", "dog", "act", "cattle"} {
+		trie.Insert(key, 0)
+	}
+
+	t.Run("ordered by distance then key", func(t *testing.T) {
+		want := []KeyDistance{{"cat", 0}, {"cart", 1}, {"cast", 1}, {"coat", 1}, {"a", 2}, {"act", 2}}
+		assert.Equal(t, want, trie.NearestKeys("cat", 6))
+		assert.Equal(t, want[:2], trie.NearestKeys("cat", 2))
+	})
+	t.Run("limit above the number of keys", func(t *testing.T) {
+		got := trie.NearestKeys("dot", 100)
+		assert.Equal(t, 8, len(got))
+		assert.Equal(t, KeyDistance{"dog", 1}, got[0])
+		assert.Equal(t, KeyDistance{"cattle", 5}, got[7])
+	})
+	t.Run("no keys", func(t *testing.T) {
+		assert.Equal(t, []KeyDistance{}, trie.NearestKeys("cat", 0))
+		assert.Equal(t, []KeyDistance{}, NewTrie[int]().NearestKeys("cat", 3))
+	})
+	t.Run("empty key", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("", 0)
+		trie.Insert("ab", 0)
+		assert.Equal(t, []KeyDistance{{"", 1}}, trie.NearestKeys("b", 1))
+		assert.Equal(t, []KeyDistance{{"ab", 0}, {"", 2}}, trie.NearestKeys("ab", 2))
+	})
+}
+
+func TestTrieHammingSearch(t *testing.T) {
+	trie := NewTrie[int]()
+	for i, key := range []string{"AB-100", "AB-101", "AB-110", "AC-100", "XY-999", "AB-10", "AB-1000", "ÅB-100"} {
+		trie.Insert(key, i)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		maxSubs int
+		want    []string
+	}{
+		{"distance 0", "AB-100", 0, []string{"AB-100"}},
+		{"distance 1", "AB-100", 1, []string{"AB-100", "AB-101", "AB-110", "AC-100", "ÅB-100"}},
+		{"boundary", "AC-101", 1, []string{"AB-101", "AC-100"}},
+		{"just past the boundary", "AC-111", 1, []string{}},
+		{"every position", "XY-999", 6, []string{"AB-100", "AB-101", "AB-110", "AC-100", "XY-999", "ÅB-100"}},
+		{"lengths must match", "AB-10", 1, []string{"AB-10"}},
+		{"no match", "ZZ-000", 0, []string{}},
+		{"negative budget", "AB-100", -1, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, trie.HammingSearch(tt.query, tt.maxSubs))
+		})
+	}
+	t.Run("empty query", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("", 0)
+		trie.Insert("a", 0)
+		assert.Equal(t, []string{""}, trie.HammingSearch("", 2))
+	})
+}
@@ -0,0 +1,188 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"unicode"
+)
+
+var ErrInvalidPattern = errors.New("invalid glob pattern")
+
+// globToken is one element of a parsed glob pattern: a literal rune, '?' or '*'
+type globToken struct {
+	literal rune
+	any     bool
+	star    bool
+}
+
+// parseGlob splits pattern into tokens. A backslash makes the rune after it literal, so `\*` matches a '*'.
+// Runs of '*' are collapsed into one, since they match the same keys.
+func parseGlob(pattern string) ([]globToken, error) {
+	tokens := []globToken{}
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			tokens = append(tokens, globToken{literal: r})
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '?':
+			tokens = append(tokens, globToken{any: true})
+		case r == '*':
+			if len(tokens) == 0 || !tokens[len(tokens)-1].star {
+				tokens = append(tokens, globToken{star: true})
+			}
+		default:
+			tokens = append(tokens, globToken{literal: r})
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("%w: %q ends with an unfinished escape", ErrInvalidPattern, pattern)
+	}
+	return tokens, nil
+}
+
+// GlobSearch returns every key matching the shell-style pattern, in lexicographic order.
+// '*' matches any run of runes, including none, '?' matches any single rune, and a backslash escapes the rune after it.
+// It returns ErrInvalidPattern if the pattern ends with a lone backslash.
+// The literal runes before the first wildcard are looked up directly, so only the subtree below them is searched.
+// Below that, every pattern position a key could have reached is tracked at once, so a subtree is skipped
+// as soon as no position is left, and a key matching in several ways is only visited and returned once.
+func (t *Trie[T]) GlobSearch(pattern string) ([]string, error) {
+	tokens, err := parseGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	// keys never hold skipped runes, so they are dropped from the pattern like from any other key
+	tokens = slices.DeleteFunc(tokens, func(token globToken) bool {
+		return !token.any && !token.star && t.skipRune(token.literal)
+	})
+	keys := []string{}
+	prefix := []rune{}
+	for _, token := range tokens {
+		if token.any || token.star {
+			break
+		}
+		prefix = append(prefix, token.literal)
+	}
+	node := search(t.Root, prefix)
+	if node == nil {
+		return keys, nil
+	}
+	states := globClosure(tokens, []int{len(prefix)})
+	return globSearch(node, tokens, states, prefix, keys), nil
+}
+
+// globClosure adds to states the positions reached by letting a '*' match nothing, keeping them sorted and unique
+func globClosure(tokens []globToken, states []int) []int {
+	closed := []int{}
+	for _, p := range states {
+		for {
+			if len(closed) > 0 && closed[len(closed)-1] >= p {
+				break
+			}
+			closed = append(closed, p)
+			if p == len(tokens) || !tokens[p].star {
+				break
+			}
+			p++
+		}
+	}
+	return closed
+}
+
+// globSearch appends the matching keys at and below node, which was reached at the sorted pattern positions in states
+func globSearch[T any](node *Node[T], tokens []globToken, states []int, key []rune, keys []string) []string {
+	if node.IsEnd && states[len(states)-1] == len(tokens) {
+		keys = append(keys, string(key))
+	}
+	for _, child := range node.Children {
+		next := []int{}
+		for _, p := range states {
+			switch {
+			case p == len(tokens):
+			case tokens[p].star:
+				next = append(next, p)
+			case tokens[p].any || tokens[p].literal == child.KeyRune:
+				next = append(next, p+1)
+			}
+		}
+		if len(next) == 0 {
+			continue
+		}
+		keys = globSearch(child, tokens, globClosure(tokens, next), append(key, child.KeyRune), keys)
+	}
+	return keys
+}
+
+// runeClasses maps the escapes ClassSearch accepts to the runes they match
+var runeClasses = map[rune]func(rune) bool{
+	'd': unicode.IsDigit,
+	'w': unicode.IsLetter,
+	's': unicode.IsSpace,
+}
+
+// classToken is one rune of a ClassSearch pattern: a literal rune, or a class if match is set
+type classToken struct {
+	literal rune
+	match   func(rune) bool
+}
+
+// parseClasses splits pattern into tokens. A backslash before any rune other than a class letter makes it literal,
+// and a trailing backslash is literal too.
+func parseClasses(pattern string) []classToken {
+	tokens := []classToken{}
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			tokens = append(tokens, classToken{literal: r, match: runeClasses[r]})
+			escaped = false
+		case r == '\\':
+			escaped = true
+		default:
+			tokens = append(tokens, classToken{literal: r})
+		}
+	}
+	if escaped {
+		tokens = append(tokens, classToken{literal: '\\'})
+	}
+	return tokens
+}
+
+// ClassSearch returns every key matching pattern rune for rune, in lexicographic order.
+// `\d` matches any digit, `\w` any letter and `\s` any space, as unicode.IsDigit, IsLetter and IsSpace report them,
+// while any other rune, or a rune escaped with a backslash such as `\\`, matches itself.
+// Keys must be exactly as long as the pattern. Literal runes are looked up directly,
+// so only the children matching a class are branched into.
+func (t *Trie[T]) ClassSearch(pattern string) []string {
+	tokens := slices.DeleteFunc(parseClasses(pattern), func(token classToken) bool {
+		return token.match == nil && t.skipRune(token.literal)
+	})
+	return classSearch(t.Root, tokens, []rune{}, []string{})
+}
+
+// classSearch appends the keys below node which match tokens, where key is node's key
+func classSearch[T any](node *Node[T], tokens []classToken, key []rune, keys []string) []string {
+	if len(tokens) == 0 {
+		if node.IsEnd {
+			keys = append(keys, string(key))
+		}
+		return keys
+	}
+	token := tokens[0]
+	if token.match == nil {
+		if next := child(node, token.literal); next != nil {
+			keys = classSearch(next, tokens[1:], append(key, token.literal), keys)
+		}
+		return keys
+	}
+	for _, child := range node.Children {
+		if token.match(child.KeyRune) {
+			keys = classSearch(child, tokens[1:], append(key, child.KeyRune), keys)
+		}
+	}
+	return keys
+}
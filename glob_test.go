@@ -0,0 +1,75 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieGlobSearch(t *testing.T) {
+	trie := NewTrie[int]()
+	for i, key := range []string{"", "abc", "abcabc", "ac", "bac", "cab", "caddic", "car", "cat", "catalog", "c*t"} {
+		trie.Insert(key, i)
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"ca*", []string{"cab", "caddic", "car", "cat", "catalog"}},
+		{"*c", []string{"abc", "abcabc", "ac", "bac", "caddic"}},
+		{"c*c", []string{"caddic"}},
+		{"a*c", []string{"abc", "abcabc", "ac"}},
+		{"*ab*", []string{"abc", "abcabc", "cab"}},
+		{"ca?", []string{"cab", "car", "cat"}},
+		{"?a?", []string{"bac", "cab", "car", "cat"}},
+		{"ca*c?", []string{}},
+		{"ca**t*", []string{"cat", "catalog"}},
+		{"*", []string{"", "abc", "abcabc", "ac", "bac", "c*t", "cab", "caddic", "car", "cat", "catalog"}},
+		{"", []string{""}},
+		{"cat", []string{"cat"}},
+		{"dog*", []string{}},
+		{`c\*t`, []string{"c*t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := trie.GlobSearch(tt.pattern)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("malformed pattern", func(t *testing.T) {
+		_, err := trie.GlobSearch(`ca\`)
+		assert.ErrorIs(t, err, ErrInvalidPattern)
+	})
+}
+
+func TestTrieClassSearch(t *testing.T) {
+	trie := NewTrie[int]()
+	for i, key := range []string{"abc123", "abc12x", "abc١٢٣", "abcdef", "abc 12", "a b", "a\tb", `a\b`, "ab", "x1y2"} {
+		trie.Insert(key, i)
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{`abc\d\d\d`, []string{"abc123", "abc١٢٣"}},
+		{`abc\d\d\w`, []string{"abc12x"}},
+		{`abc\w\w\w`, []string{"abcdef"}},
+		{`abc\s\d\d`, []string{"abc 12"}},
+		{`a\sb`, []string{"a\tb", "a b"}},
+		{`\w\d\w\d`, []string{"x1y2"}},
+		{`a\\b`, []string{`a\b`}},
+		{`\w\w`, []string{"ab"}},
+		{`abc\d\d`, []string{}},
+		{"ab", []string{"ab"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert.Equal(t, tt.want, trie.ClassSearch(tt.pattern))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package trie
+
+import "slices"
+
+// ImmutableTrie is a persistent trie: Insert leaves the trie unchanged and returns a new version.
+// Only the nodes on the path to the inserted key are copied, every other subtree is shared between versions,
+// so keeping many versions costs little more than the keys that differ between them.
+type ImmutableTrie[T any] struct {
+	root *Node[T]
+	len  int
+}
+
+func NewImmutableTrie[T any]() *ImmutableTrie[T] {
+	return &ImmutableTrie[T]{
+		root: &Node[T]{Children: []*Node[T]{}},
+	}
+}
+
+// Insert returns a new version of the trie with key set to value, replacing the value if key already exists.
+func (t *ImmutableTrie[T]) Insert(key string, value T) *ImmutableTrie[T] {
+	root := copyNode(t.root)
+	node := root
+	for _, r := range key {
+		i, found := childIndex(node, r)
+		var next *Node[T]
+		if found {
+			next = copyNode(node.Children[i])
+			node.Children[i] = next
+			if node.childMap != nil {
+				node.childMap[r] = next
+			}
+		} else {
+			next = &Node[T]{
+				Children: []*Node[T]{},
+				KeyRune:  r,
+			}
+			insertChild(node, i, next)
+		}
+		node = next
+	}
+	n := t.len
+	if !node.IsEnd {
+		n++
+	}
+	node.IsEnd = true
+	node.Value = value
+	return &ImmutableTrie[T]{root: root, len: n}
+}
+
+// copyNode returns a copy of node which shares its children
+func copyNode[T any](node *Node[T]) *Node[T] {
+	c := &Node[T]{
+		Value:       node.Value,
+		Children:    slices.Clone(node.Children),
+		KeyRune:     node.KeyRune,
+		IsEnd:       node.IsEnd,
+		seq:         node.seq,
+		softDeleted: node.softDeleted,
+	}
+	indexChildren(c)
+	return c
+}
+
+func (t *ImmutableTrie[T]) Search(key string) (T, error) {
+	node := search(t.root, []rune(key))
+	if node == nil || !node.IsEnd {
+		return *new(T), keyError(key, ErrNotFound)
+	}
+	return node.Value, nil
+}
+
+func (t *ImmutableTrie[T]) Contains(key string) bool {
+	_, err := t.Search(key)
+	return err == nil
+}
+
+// GetAll returns every key in this version in lexicographic order.
+func (t *ImmutableTrie[T]) GetAll() []string {
+	fun := func(node *Node[T], key string, accumulator []string) []string {
+		return append(accumulator, key)
+	}
+	return depthFirstSearchKeys(t.root, fun, []string{})
+}
+
+// Len returns the number of keys in this version, without a traversal.
+func (t *ImmutableTrie[T]) Len() int {
+	return t.len
+}
@@ -0,0 +1,56 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImmutableTrieInsert(t *testing.T) {
+	t.Run("old versions are unchanged", func(t *testing.T) {
+		v0 := NewImmutableTrie[int]()
+		v1 := v0.Insert("apple", 1).Insert("banana", 2)
+		v2 := v1.Insert("apricot", 3)
+		v3 := v2.Insert("apple", 10)
+
+		assert.Equal(t, []string{}, v0.GetAll())
+		assert.Equal(t, []string{"apple", "banana"}, v1.GetAll())
+		assert.Equal(t, []string{"apple", "apricot", "banana"}, v2.GetAll())
+		assert.Equal(t, []string{"apple", "apricot", "banana"}, v3.GetAll())
+
+		got, _ := v2.Search("apple")
+		assert.Equal(t, 1, got)
+		got, _ = v3.Search("apple")
+		assert.Equal(t, 10, got)
+		_, err := v1.Search("apricot")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.Equal(t, 0, v0.Len())
+		assert.Equal(t, 2, v1.Len())
+		assert.Equal(t, 3, v2.Len())
+		assert.Equal(t, 3, v3.Len())
+	})
+	t.Run("unchanged subtrees are shared", func(t *testing.T) {
+		v1 := NewImmutableTrie[int]().Insert("apple", 1).Insert("banana", 2)
+		v2 := v1.Insert("apricot", 3)
+
+		b1, _ := childIndex(v1.root, 'b')
+		b2, _ := childIndex(v2.root, 'b')
+		assert.Same(t, v1.root.Children[b1], v2.root.Children[b2])
+
+		// the path to the new key is copied
+		assert.NotSame(t, v1.root, v2.root)
+		assert.NotSame(t, v1.root.Children[0], v2.root.Children[0])
+		// but the apple subtree below it is shared
+		appl1 := search(v1.root, []rune("appl"))
+		appl2 := search(v2.root, []rune("appl"))
+		assert.Same(t, appl1, appl2)
+	})
+	t.Run("prefix of an existing key", func(t *testing.T) {
+		v1 := NewImmutableTrie[int]().Insert("keys", 1)
+		v2 := v1.Insert("key", 2)
+		assert.True(t, v2.Contains("key"))
+		assert.False(t, v1.Contains("key"))
+		assert.Equal(t, []string{"key", "keys"}, v2.GetAll())
+	})
+}
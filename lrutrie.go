@@ -0,0 +1,102 @@
+package trie
+
+import "container/list"
+
+// LRUTrie is a trie holding at most a fixed number of keys, which evicts the least recently used key
+// when an insert goes over capacity. Inserting or looking up a key counts as using it.
+type LRUTrie[T any] struct {
+	// trie holds each key's element in recency, so lookups can move it to the front
+	trie *Trie[*list.Element]
+	// recency holds an lruEntry for every key, most recently used first
+	recency  *list.List
+	capacity int
+}
+
+type lruEntry[T any] struct {
+	key   string
+	value T
+}
+
+// NewLRUTrie returns a trie holding at most capacity keys. A capacity below 1 is raised to 1,
+// since a trie without room for the key just inserted would accept every insert and keep nothing.
+func NewLRUTrie[T any](capacity int) *LRUTrie[T] {
+	return &LRUTrie[T]{
+		trie:     NewTrie[*list.Element](),
+		recency:  list.New(),
+		capacity: max(capacity, 1),
+	}
+}
+
+// Insert adds key as the most recently used key, evicting the least recently used keys if there are more than capacity.
+// It returns ErrAlreadyExists if key is in the trie, without counting as a use.
+func (l *LRUTrie[T]) Insert(key string, value T) error {
+	if l.trie.Contains(key) {
+		return keyError(key, ErrAlreadyExists)
+	}
+	elem := l.recency.PushFront(lruEntry[T]{key: key, value: value})
+	if err := l.trie.Insert(key, elem); err != nil {
+		l.recency.Remove(elem)
+		return err
+	}
+	for l.recency.Len() > l.capacity {
+		l.evict()
+	}
+	return nil
+}
+
+// evict deletes the least recently used key
+func (l *LRUTrie[T]) evict() {
+	oldest := l.recency.Back()
+	l.recency.Remove(oldest)
+	_, _ = l.trie.Delete(oldest.Value.(lruEntry[T]).key)
+}
+
+// Search returns key's value and makes it the most recently used key.
+func (l *LRUTrie[T]) Search(key string) (T, error) {
+	elem, err := l.trie.Search(key)
+	if err != nil {
+		return *new(T), err
+	}
+	l.recency.MoveToFront(elem)
+	return elem.Value.(lruEntry[T]).value, nil
+}
+
+// Contains reports whether key is in the trie, without counting as a use.
+func (l *LRUTrie[T]) Contains(key string) bool {
+	return l.trie.Contains(key)
+}
+
+// PrefixSearch returns every key starting with prefix, in lexicographic order, and counts each as used.
+// They are used in the order returned, so the last key is the most recently used.
+func (l *LRUTrie[T]) PrefixSearch(prefix string) []string {
+	keys := l.trie.PrefixSearch(prefix)
+	for _, key := range keys {
+		elem, _ := l.trie.Search(key)
+		l.recency.MoveToFront(elem)
+	}
+	return keys
+}
+
+// Delete removes key and returns its value.
+func (l *LRUTrie[T]) Delete(key string) (T, error) {
+	elem, err := l.trie.Delete(key)
+	if err != nil {
+		return *new(T), err
+	}
+	l.recency.Remove(elem)
+	return elem.Value.(lruEntry[T]).value, nil
+}
+
+// Len returns the number of keys in the trie, which is at most its capacity.
+func (l *LRUTrie[T]) Len() int {
+	return l.recency.Len()
+}
+
+// Keys returns every key from the most to the least recently used.
+func (l *LRUTrie[T]) Keys() []string {
+	keys := make([]string, 0, l.recency.Len())
+	for elem := l.recency.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(lruEntry[T]).key)
+	}
+	return keys
+}
@@ -0,0 +1,71 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUTrie(t *testing.T) {
+	t.Run("evicts the least recently inserted", func(t *testing.T) {
+		trie := NewLRUTrie[int](3)
+		for i, key := range []string{"a", "ab", "abc", "b", "bc"} {
+			assert.Nil(t, trie.Insert(key, i))
+		}
+		assert.Equal(t, 3, trie.Len())
+		assert.Equal(t, []string{"bc", "b", "abc"}, trie.Keys())
+		assert.False(t, trie.Contains("a"))
+		assert.False(t, trie.Contains("ab"))
+		assert.Equal(t, []string{"abc"}, trie.PrefixSearch("a"))
+	})
+	t.Run("capacity below one holds one key", func(t *testing.T) {
+		for _, capacity := range []int{0, -1} {
+			trie := NewLRUTrie[int](capacity)
+			assert.Nil(t, trie.Insert("a", 1))
+			assert.Nil(t, trie.Insert("b", 2))
+			assert.Equal(t, []string{"b"}, trie.Keys())
+			assert.False(t, trie.Contains("a"))
+		}
+	})
+	t.Run("used keys survive", func(t *testing.T) {
+		trie := NewLRUTrie[int](3)
+		trie.Insert("a", 1)
+		trie.Insert("b", 2)
+		trie.Insert("c", 3)
+		got, err := trie.Search("a")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, got)
+
+		trie.Insert("d", 4)
+		assert.Equal(t, []string{"d", "a", "c"}, trie.Keys())
+		_, err = trie.Search("b")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// a prefix search uses every key it returns
+		assert.Equal(t, []string{"c"}, trie.PrefixSearch("c"))
+		trie.Insert("e", 5)
+		assert.Equal(t, []string{"e", "c", "d"}, trie.Keys())
+	})
+	t.Run("contains and failed inserts are not uses", func(t *testing.T) {
+		trie := NewLRUTrie[int](2)
+		trie.Insert("a", 1)
+		trie.Insert("b", 2)
+		assert.True(t, trie.Contains("a"))
+		assert.ErrorIs(t, trie.Insert("a", 3), ErrAlreadyExists)
+		trie.Insert("c", 3)
+		assert.Equal(t, []string{"c", "b"}, trie.Keys())
+	})
+	t.Run("delete frees capacity", func(t *testing.T) {
+		trie := NewLRUTrie[int](2)
+		trie.Insert("a", 1)
+		trie.Insert("b", 2)
+		got, err := trie.Delete("a")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, got)
+		_, err = trie.Delete("a")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		trie.Insert("c", 3)
+		assert.Equal(t, []string{"c", "b"}, trie.Keys())
+	})
+}
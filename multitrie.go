@@ -0,0 +1,67 @@
+package trie
+
+// MultiTrie is a trie where a key may hold several values, kept in the order they were appended.
+type MultiTrie[T any] struct {
+	trie *Trie[[]T]
+}
+
+func NewMultiTrie[T any]() *MultiTrie[T] {
+	return &MultiTrie[T]{
+		trie: NewTrie[[]T](),
+	}
+}
+
+// Append adds value to the values stored at key, creating the key if it does not exist.
+// It returns an error if the key is rejected, such as one containing the NUL rune, see ErrInvalidRune.
+func (m *MultiTrie[T]) Append(key string, value T) error {
+	runes, err := m.trie.prepareWrite([]rune(key))
+	if err != nil {
+		return keyError(key, err)
+	}
+	node := search(m.trie.Root, runes)
+	if node != nil && node.IsEnd {
+		node.Value = append(node.Value, value)
+		return nil
+	}
+	return m.trie.Insert(key, []T{value})
+}
+
+// Search returns every value stored at key, in the order they were appended.
+func (m *MultiTrie[T]) Search(key string) ([]T, error) {
+	return m.trie.Search(key)
+}
+
+// Delete removes key along with all of its values, and returns the removed values.
+func (m *MultiTrie[T]) Delete(key string) ([]T, error) {
+	return m.trie.Delete(key)
+}
+
+// DeleteValue removes the first value stored at key for which match returns true.
+// The key is deleted once its last value is removed.
+func (m *MultiTrie[T]) DeleteValue(key string, match func(T) bool) (T, error) {
+	node := search(m.trie.Root, []rune(key))
+	if node == nil || !node.IsEnd {
+		return *new(T), keyError(key, ErrNotFound)
+	}
+	for i, value := range node.Value {
+		if !match(value) {
+			continue
+		}
+		if len(node.Value) == 1 {
+			_, err := m.trie.Delete(key)
+			return value, err
+		}
+		node.Value = append(node.Value[:i], node.Value[i+1:]...)
+		return value, nil
+	}
+	return *new(T), keyError(key, ErrNotFound)
+}
+
+func (m *MultiTrie[T]) GetAll() []string {
+	return m.trie.GetAll()
+}
+
+// Len returns the number of keys, not values, in the trie.
+func (m *MultiTrie[T]) Len() int {
+	return m.trie.Len()
+}
@@ -0,0 +1,83 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiTrieAppend(t *testing.T) {
+	t.Run("append several values to one key", func(t *testing.T) {
+		trie := NewMultiTrie[string]()
+		trie.Append("go", "lang")
+		trie.Append("go", "game")
+		trie.Append("gopher", "mascot")
+		trie.Append("go", "verb")
+
+		got, err := trie.Search("go")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"lang", "game", "verb"}, got)
+
+		got, err = trie.Search("gopher")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"mascot"}, got)
+		assert.Equal(t, 2, trie.Len())
+	})
+	t.Run("rejected key returns error", func(t *testing.T) {
+		trie := NewMultiTrie[string]()
+		assert.ErrorIs(t, trie.Append("a\x00", "nul"), ErrInvalidRune)
+		assert.Equal(t, 0, trie.Len())
+	})
+	t.Run("search absent key returns error", func(t *testing.T) {
+		trie := NewMultiTrie[string]()
+		trie.Append("gopher", "mascot")
+
+		got, err := trie.Search("go")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Nil(t, got)
+	})
+}
+
+func TestMultiTrieDelete(t *testing.T) {
+	t.Run("delete whole key", func(t *testing.T) {
+		trie := NewMultiTrie[int]()
+		trie.Append("a", 1)
+		trie.Append("a", 2)
+		trie.Append("ab", 3)
+
+		got, err := trie.Delete("a")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []int{1, 2}, got)
+		assert.Equal(t, []string{"ab"}, trie.GetAll())
+	})
+	t.Run("delete single value keeps order of the rest", func(t *testing.T) {
+		trie := NewMultiTrie[int]()
+		trie.Append("a", 1)
+		trie.Append("a", 2)
+		trie.Append("a", 3)
+
+		got, err := trie.DeleteValue("a", func(v int) bool { return v == 2 })
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 2, got)
+		values, _ := trie.Search("a")
+		assert.Equal(t, []int{1, 3}, values)
+	})
+	t.Run("deleting the last value removes the key", func(t *testing.T) {
+		trie := NewMultiTrie[int]()
+		trie.Append("a", 1)
+
+		_, err := trie.DeleteValue("a", func(v int) bool { return v == 1 })
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{}, trie.GetAll())
+		assert.Equal(t, 0, len(trie.trie.Root.Children))
+	})
+	t.Run("deleting an absent value returns error", func(t *testing.T) {
+		trie := NewMultiTrie[int]()
+		trie.Append("a", 1)
+
+		_, err := trie.DeleteValue("a", func(v int) bool { return v == 5 })
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = trie.DeleteValue("b", func(v int) bool { return true })
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
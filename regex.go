@@ -0,0 +1,82 @@
+package trie
+
+import (
+	"regexp"
+	"strings"
+)
+
+// matchNothing is a regular expression no string matches, for a trie without keys
+const matchNothing = `[^\x00-\x{10FFFF}]`
+
+// ToRegex returns a regular expression matching the keys of the trie, with common prefixes shared
+// like the trie shares them, so "caat", "caalc" and "caalm" give (?:caa(?:l[cm]|t)).
+// Keys that are single runes apart become a character class, and metacharacters in keys are escaped.
+// Anchored as ^...$ it matches exactly the keys, and a trie without keys gives a pattern matching nothing.
+func (t *Trie[T]) ToRegex() string {
+	pattern, atom := regexAlternation(t.Root)
+	if pattern == "" {
+		if t.Root.IsEnd {
+			return "(?:)"
+		}
+		return matchNothing
+	}
+	if t.Root.IsEnd {
+		pattern = regexOptional(pattern, atom)
+	}
+	return "(?:" + pattern + ")"
+}
+
+// regexAlternation returns a pattern matching the non-empty suffixes of the keys below node, or "" if there are none,
+// and whether it is a single atom which can take a quantifier as it is
+func regexAlternation[T any](node *Node[T]) (string, bool) {
+	alternatives := []string{}
+	// runes ending a key with nothing below, which go in a character class
+	runes := []rune{}
+	for _, child := range node.Children {
+		suffix, atom := regexAlternation(child)
+		if suffix == "" {
+			// without keys below, the child is either a key's last rune or, once soft deleted, no key at all
+			if child.IsEnd {
+				runes = append(runes, child.KeyRune)
+			}
+			continue
+		}
+		if child.IsEnd {
+			suffix = regexOptional(suffix, atom)
+		}
+		alternatives = append(alternatives, regexp.QuoteMeta(string(child.KeyRune))+suffix)
+	}
+	switch len(runes) {
+	case 0:
+	case 1:
+		alternatives = append(alternatives, regexp.QuoteMeta(string(runes[0])))
+	default:
+		var class strings.Builder
+		class.WriteByte('[')
+		for _, r := range runes {
+			// QuoteMeta leaves '-' alone, which would make a range
+			if r == '-' {
+				class.WriteByte('\\')
+			}
+			class.WriteString(regexp.QuoteMeta(string(r)))
+		}
+		class.WriteByte(']')
+		alternatives = append(alternatives, class.String())
+	}
+	switch {
+	case len(alternatives) == 0:
+		return "", false
+	case len(alternatives) > 1:
+		return "(?:" + strings.Join(alternatives, "|") + ")", true
+	}
+	// a lone rune or character class is an atom, a longer suffix is not
+	return alternatives[0], len(runes) > 0
+}
+
+// regexOptional makes pattern optional, grouping it first unless it is an atom
+func regexOptional(pattern string, atom bool) string {
+	if atom {
+		return pattern + "?"
+	}
+	return "(?:" + pattern + ")?"
+}
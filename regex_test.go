@@ -0,0 +1,59 @@
+package trie
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieToRegex(t *testing.T) {
+	// matches reports which of keys the pattern matches in full
+	matches := func(pattern string, keys []string) []string {
+		re := regexp.MustCompile("^" + pattern + "$")
+		matched := []string{}
+		for _, key := range keys {
+			if re.MatchString(key) {
+				matched = append(matched, key)
+			}
+		}
+		return matched
+	}
+
+	t.Run("shares prefixes", func(t *testing.T) {
+		assert.Equal(t, "(?:caa(?:l[cm]|t))", newTrieOfKeys("caat", "caalc", "caalm").ToRegex())
+		assert.Equal(t, "(?:caa(?:lc[ru]?|t))", newTrieOfKeys("caat", "caalc", "caalcu", "caalcr").ToRegex())
+		assert.Equal(t, "(?:car(?:ts?)?)", newTrieOfKeys("car", "cart", "carts").ToRegex())
+	})
+	t.Run("matches exactly the keys", func(t *testing.T) {
+		trie := newFixtureTrie()
+		pattern := trie.ToRegex()
+		keys := trie.GetAll()
+		assert.Equal(t, keys, matches(pattern, keys))
+		nonKeys := []string{"", "c", "caa", "caal", "caatt", "a", "asks", "caalcx", "caable!"}
+		assert.Equal(t, []string{}, matches(pattern, nonKeys))
+	})
+	t.Run("metacharacters escaped", func(t *testing.T) {
+		keys := []string{"a.b", "a*", "a-", "a]", "(x|y)", `\d`, "$^", "a+b", "日本"}
+		pattern := newTrieOfKeys(keys...).ToRegex()
+		assert.ElementsMatch(t, keys, matches(pattern, keys))
+		assert.Equal(t, []string{}, matches(pattern, []string{"axb", "aa", "a", "ab", "x", "0", "a++b"}))
+	})
+	t.Run("empty key", func(t *testing.T) {
+		pattern := newTrieOfKeys("", "a", "ab").ToRegex()
+		assert.Equal(t, []string{"", "a", "ab"}, matches(pattern, []string{"", "a", "ab", "b"}))
+		assert.Equal(t, []string{""}, matches(newTrieOfKeys("").ToRegex(), []string{"", "a"}))
+	})
+	t.Run("soft deleted keys left out", func(t *testing.T) {
+		trie := newTrieOfKeys("ab", "ac", "adx", "ad")
+		trie.SoftDelete("ac")
+		trie.SoftDelete("adx")
+		assert.Equal(t, "(?:a[bd])", trie.ToRegex())
+		trie.SoftDelete("ab")
+		trie.SoftDelete("ad")
+		assert.Equal(t, []string{}, matches(trie.ToRegex(), []string{"", "a", "ab", "ac", "ad", "adx"}))
+	})
+	t.Run("no keys", func(t *testing.T) {
+		assert.Equal(t, []string{}, matches(newTrieOfKeys().ToRegex(), []string{"", "a"}))
+	})
+}
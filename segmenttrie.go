@@ -0,0 +1,87 @@
+package trie
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("path has no segments or a segment containing the separator")
+
+// SegmentTrie is a trie whose nodes are keyed on whole segments of a key split by a separator, rather than on runes.
+// With separator "/", "a/b" is a prefix of "a/b/c" but not of "a/bc".
+// It is a SliceTrie of segments, with string keys split and joined around it.
+type SegmentTrie[T any] struct {
+	trie      *SliceTrie[string, T]
+	separator string
+}
+
+func NewSegmentTrie[T any](separator string) *SegmentTrie[T] {
+	t := &SegmentTrie[T]{
+		trie:      NewSliceTrie[string, T](),
+		separator: separator,
+	}
+	t.trie.keyString = t.joinPath
+	return t
+}
+
+func (t *SegmentTrie[T]) Insert(key string, value T) error {
+	return t.InsertPath(strings.Split(key, t.separator), value)
+}
+
+// InsertPath inserts the key made of segments, for callers which already have them, without joining and splitting.
+// It returns ErrInvalidPath if there are no segments, or a segment contains the separator, since such keys
+// couldn't be told apart from others once joined, so every key stays reachable by Insert's string form too.
+func (t *SegmentTrie[T]) InsertPath(segments []string, value T) error {
+	if len(segments) == 0 || (t.separator != "" && slices.ContainsFunc(segments, t.hasSeparator)) {
+		return keyError(t.joinPath(segments), ErrInvalidPath)
+	}
+	return t.trie.Insert(segments, value)
+}
+
+func (t *SegmentTrie[T]) hasSeparator(segment string) bool {
+	return strings.Contains(segment, t.separator)
+}
+
+func (t *SegmentTrie[T]) Search(key string) (T, error) {
+	return t.SearchPath(strings.Split(key, t.separator))
+}
+
+// SearchPath returns the value of the key made of segments, like InsertPath.
+func (t *SegmentTrie[T]) SearchPath(segments []string) (T, error) {
+	return t.trie.Search(segments)
+}
+
+// Delete removes key and returns its value, along with every node left without a key below it.
+func (t *SegmentTrie[T]) Delete(key string) (T, error) {
+	return t.DeletePath(strings.Split(key, t.separator))
+}
+
+// DeletePath removes the key made of segments like Delete, taking segments like InsertPath.
+func (t *SegmentTrie[T]) DeletePath(segments []string) (T, error) {
+	return t.trie.Delete(segments)
+}
+
+// joinPath joins segments into a key for a KeyError
+func (t *SegmentTrie[T]) joinPath(segments []string) string {
+	return strings.Join(segments, t.separator)
+}
+
+// PrefixSearch returns every key made of prefix's segments followed by zero or more further segments,
+// ordered segment by segment. An empty prefix has no segments, so every key is listed.
+func (t *SegmentTrie[T]) PrefixSearch(prefix string) []string {
+	var path []string
+	if prefix != "" {
+		path = strings.Split(prefix, t.separator)
+	}
+	keys := []string{}
+	t.trie.WalkPrefix(path, func(segments []string, value T) {
+		keys = append(keys, t.joinPath(segments))
+	})
+	return keys
+}
+
+// Len returns the number of keys in the trie.
+func (t *SegmentTrie[T]) Len() int {
+	return t.trie.Len()
+}
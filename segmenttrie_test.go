@@ -0,0 +1,95 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentTrie(t *testing.T) {
+	newPaths := func() *SegmentTrie[int] {
+		trie := NewSegmentTrie[int]("/")
+		trie.Insert("a/b", 1)
+		trie.Insert("a/bc", 2)
+		trie.Insert("a/b/c", 3)
+		trie.Insert("a/b/d/e", 4)
+		trie.Insert("x", 5)
+		return trie
+	}
+
+	t.Run("prefixes end on segment boundaries", func(t *testing.T) {
+		trie := newPaths()
+		assert.Equal(t, []string{"a/b", "a/b/c", "a/b/d/e"}, trie.PrefixSearch("a/b"))
+		assert.Equal(t, []string{"a/bc"}, trie.PrefixSearch("a/bc"))
+		assert.Equal(t, []string{}, trie.PrefixSearch("a/b/d/e/f"))
+		// a partial segment is not a prefix
+		assert.Equal(t, []string{}, trie.PrefixSearch("a/"))
+		assert.Equal(t, []string{"a/b", "a/b/c", "a/b/d/e", "a/bc"}, trie.PrefixSearch("a"))
+	})
+	t.Run("empty prefix lists every key", func(t *testing.T) {
+		trie := newPaths()
+		assert.Equal(t, []string{"a/b", "a/b/c", "a/b/d/e", "a/bc", "x"}, trie.PrefixSearch(""))
+		trie.Insert("", 0)
+		assert.Equal(t, []string{"", "a/b", "a/b/c", "a/b/d/e", "a/bc", "x"}, trie.PrefixSearch(""))
+	})
+	t.Run("insert and search", func(t *testing.T) {
+		trie := newPaths()
+		got, err := trie.Search("a/bc")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, got)
+		_, err = trie.Search("a")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = trie.Search("a/b/d")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, trie.Insert("a/b", 0), ErrAlreadyExists)
+		assert.Equal(t, 5, trie.Len())
+	})
+	t.Run("delete removes empty segments", func(t *testing.T) {
+		trie := newPaths()
+		got, err := trie.Delete("a/b/d/e")
+		assert.Nil(t, err)
+		assert.Equal(t, 4, got)
+		assert.Equal(t, []string{"a/b", "a/b/c"}, trie.PrefixSearch("a/b"))
+		b := trie.trie.path([]string{"a", "b"})
+		assert.Equal(t, 1, len(b[len(b)-1].children))
+
+		_, err = trie.Delete("a/b/d")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 4, trie.Len())
+	})
+	t.Run("paths of segments", func(t *testing.T) {
+		trie := newPaths()
+		assert.Nil(t, trie.InsertPath([]string{"a", "b", "c", "d"}, 6))
+		assert.ErrorIs(t, trie.InsertPath([]string{"a", "b", "c"}, 0), ErrAlreadyExists)
+
+		got, err := trie.SearchPath([]string{"a", "b", "c", "d"})
+		assert.Nil(t, err)
+		assert.Equal(t, 6, got)
+		got, err = trie.Search("a/b/c/d")
+		assert.Nil(t, err)
+		assert.Equal(t, 6, got)
+
+		got, err = trie.DeletePath([]string{"a", "b", "c", "d"})
+		assert.Nil(t, err)
+		assert.Equal(t, 6, got)
+		_, err = trie.DeletePath([]string{"a", "b", "c", "d"})
+		assert.Equal(t, &KeyError{Key: "a/b/c/d", Err: ErrNotFound}, err)
+		assert.Equal(t, 5, trie.Len())
+	})
+	t.Run("ambiguous paths rejected", func(t *testing.T) {
+		trie := newPaths()
+		// "a", "b/c" would join to the same key as "a", "b", "c"
+		err := trie.InsertPath([]string{"a", "b/c"}, 0)
+		assert.Equal(t, &KeyError{Key: "a/b/c", Err: ErrInvalidPath}, err)
+		assert.ErrorIs(t, trie.InsertPath(nil, 0), ErrInvalidPath)
+		assert.ErrorIs(t, trie.InsertPath([]string{}, 0), ErrInvalidPath)
+		assert.Equal(t, 5, trie.Len())
+		assert.Equal(t, []string{"a/b", "a/b/c", "a/b/d/e", "a/bc"}, trie.PrefixSearch("a"))
+
+		// an empty segment is fine, and is how the empty key is stored
+		assert.Nil(t, trie.InsertPath([]string{""}, 6))
+		got, err := trie.Search("")
+		assert.Nil(t, err)
+		assert.Equal(t, 6, got)
+	})
+}
@@ -0,0 +1,157 @@
+package trie
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// SliceTrie is a trie keyed on slices of any ordered element type, such as []rune or []byte,
+// so rune and byte keyed tries share one implementation.
+// Trie is deliberately not rebuilt on it as a Trie[E, T]: its exported Root and Node.KeyRune fields tie it to runes,
+// and changing them would break every caller walking nodes. SliceTrie[rune, T] holds the same keys as a Trie[T],
+// but has none of its options, so keys aren't normalized, length limited or checked for NUL or allowed runes.
+// SegmentTrie is a SliceTrie[string, T].
+type SliceTrie[E cmp.Ordered, T any] struct {
+	root *sliceNode[E, T]
+	// keyString formats a key for a KeyError, see sliceKeyString
+	keyString func([]E) string
+}
+
+type sliceNode[E cmp.Ordered, T any] struct {
+	value T
+	elem  E
+	isEnd bool
+	// children are kept sorted by elem
+	children []*sliceNode[E, T]
+}
+
+func NewSliceTrie[E cmp.Ordered, T any]() *SliceTrie[E, T] {
+	return &SliceTrie[E, T]{
+		root:      &sliceNode[E, T]{},
+		keyString: sliceKeyString[E],
+	}
+}
+
+// NewByteTrie returns a trie keyed on bytes, which splits multi-byte runes of string keys over several nodes.
+func NewByteTrie[T any]() *SliceTrie[byte, T] {
+	return NewSliceTrie[byte, T]()
+}
+
+// sliceKeyString formats key for a KeyError, as a string for rune and byte keys
+func sliceKeyString[E cmp.Ordered](key []E) string {
+	switch k := any(key).(type) {
+	case []rune:
+		return string(k)
+	case []byte:
+		return string(k)
+	}
+	return fmt.Sprint(key)
+}
+
+// childIndex binary searches node's children for the child holding e, like the function of the same name for Trie
+func (node *sliceNode[E, T]) childIndex(e E) (int, bool) {
+	return slices.BinarySearchFunc(node.children, e, func(child *sliceNode[E, T], e E) int {
+		return cmp.Compare(child.elem, e)
+	})
+}
+
+// path returns the nodes from the root to key's node, or nil if it does not exist
+func (t *SliceTrie[E, T]) path(key []E) []*sliceNode[E, T] {
+	node := t.root
+	path := []*sliceNode[E, T]{node}
+	for _, e := range key {
+		i, found := node.childIndex(e)
+		if !found {
+			return nil
+		}
+		node = node.children[i]
+		path = append(path, node)
+	}
+	return path
+}
+
+func (t *SliceTrie[E, T]) Insert(key []E, value T) error {
+	node := t.root
+	for _, e := range key {
+		i, found := node.childIndex(e)
+		if !found {
+			node.children = slices.Insert(node.children, i, &sliceNode[E, T]{elem: e})
+		}
+		node = node.children[i]
+	}
+	if node.isEnd {
+		return keyError(t.keyString(key), ErrAlreadyExists)
+	}
+	node.isEnd = true
+	node.value = value
+	return nil
+}
+
+func (t *SliceTrie[E, T]) Search(key []E) (T, error) {
+	path := t.path(key)
+	if path == nil || !path[len(path)-1].isEnd {
+		return *new(T), keyError(t.keyString(key), ErrNotFound)
+	}
+	return path[len(path)-1].value, nil
+}
+
+func (t *SliceTrie[E, T]) Contains(key []E) bool {
+	path := t.path(key)
+	return path != nil && path[len(path)-1].isEnd
+}
+
+// Delete removes key and returns its value, along with every node left without a key below it.
+func (t *SliceTrie[E, T]) Delete(key []E) (T, error) {
+	path := t.path(key)
+	if path == nil || !path[len(path)-1].isEnd {
+		return *new(T), keyError(t.keyString(key), ErrNotFound)
+	}
+	node := path[len(path)-1]
+	value := node.value
+	node.isEnd = false
+	node.value = *new(T)
+	for i := len(path) - 1; i > 0 && len(path[i].children) == 0 && !path[i].isEnd; i-- {
+		parent := path[i-1]
+		j, _ := parent.childIndex(path[i].elem)
+		parent.children = slices.Delete(parent.children, j, j+1)
+	}
+	return value, nil
+}
+
+// PrefixSearch returns every key starting with prefix, in lexicographic order.
+func (t *SliceTrie[E, T]) PrefixSearch(prefix []E) [][]E {
+	keys := [][]E{}
+	t.WalkPrefix(prefix, func(key []E, value T) {
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+// WalkPrefix calls fn for every key starting with prefix in lexicographic order.
+// Each key is a new slice, so fn may keep it.
+func (t *SliceTrie[E, T]) WalkPrefix(prefix []E, fn func(key []E, value T)) {
+	path := t.path(prefix)
+	if path == nil {
+		return
+	}
+	var walk func(node *sliceNode[E, T], key []E)
+	walk = func(node *sliceNode[E, T], key []E) {
+		if node.isEnd {
+			fn(append([]E{}, key...), node.value)
+		}
+		for _, child := range node.children {
+			walk(child, append(key, child.elem))
+		}
+	}
+	walk(path[len(path)-1], append([]E{}, prefix...))
+}
+
+// Len returns the number of keys in the trie.
+func (t *SliceTrie[E, T]) Len() int {
+	n := 0
+	t.WalkPrefix(nil, func(key []E, value T) {
+		n++
+	})
+	return n
+}
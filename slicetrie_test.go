@@ -0,0 +1,47 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSliceTrie(t *testing.T) {
+	t.Run("rune keys", func(t *testing.T) {
+		trie := NewSliceTrie[rune, int]()
+		for i, key := range []string{"car", "cart", "café", "dog"} {
+			assert.Nil(t, trie.Insert([]rune(key), i))
+		}
+		assert.ErrorIs(t, trie.Insert([]rune("car"), 0), ErrAlreadyExists)
+		got, err := trie.Search([]rune("café"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, got)
+		assert.Equal(t, [][]rune{[]rune("café"), []rune("car"), []rune("cart")}, trie.PrefixSearch([]rune("ca")))
+		assert.Equal(t, 4, trie.Len())
+
+		// the same keys as a Trie, in the same order
+		want := NewTrie[int]()
+		for _, key := range trie.PrefixSearch(nil) {
+			want.InsertRunes(key, 0)
+		}
+		assert.Equal(t, []string{"café", "car", "cart", "dog"}, want.GetAll())
+	})
+	t.Run("byte keys", func(t *testing.T) {
+		trie := NewByteTrie[int]()
+		assert.Nil(t, trie.Insert([]byte("café"), 1))
+		assert.Nil(t, trie.Insert([]byte{0xff, 0x00}, 2))
+		assert.Nil(t, trie.Insert([]byte{}, 3))
+		// é is two bytes, so its first byte is a prefix
+		assert.Equal(t, [][]byte{[]byte("café")}, trie.PrefixSearch([]byte("caf\xc3")))
+		assert.True(t, trie.Contains([]byte{0xff, 0x00}))
+		assert.False(t, trie.Contains([]byte{0xff}))
+
+		val, err := trie.Delete([]byte("café"))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, val)
+		assert.Equal(t, 1, len(trie.root.children))
+		_, err = trie.Delete([]byte("café"))
+		assert.Equal(t, &KeyError{Key: "café", Err: ErrNotFound}, err)
+		assert.Equal(t, [][]byte{{}, {0xff, 0x00}}, trie.PrefixSearch(nil))
+	})
+}
@@ -0,0 +1,136 @@
+package trie
+
+import "errors"
+
+// StringSet is an ordered set of strings backed by a trie.
+// Intersection and Difference walk both tries together, so they only visit nodes shared by the two sets,
+// or those of the receiver, instead of looking up every key from the root.
+type StringSet struct {
+	trie *Trie[struct{}]
+}
+
+// NewStringSet returns a set holding keys. Keys may repeat, so an error is only returned for keys the set rejects;
+// all such errors are joined, and the set holds the other keys.
+func NewStringSet(keys ...string) (*StringSet, error) {
+	s := &StringSet{
+		trie: NewTrie[struct{}](),
+	}
+	var errs []error
+	for _, key := range keys {
+		if _, err := s.Add(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return s, errors.Join(errs...)
+}
+
+// Add adds key to the set and reports whether it was not already present.
+// It returns an error if the key is rejected, such as one containing the NUL rune, see ErrInvalidRune.
+func (s *StringSet) Add(key string) (bool, error) {
+	err := s.trie.Insert(key, struct{}{})
+	if errors.Is(err, ErrAlreadyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Remove removes key from the set and reports whether it was present.
+func (s *StringSet) Remove(key string) bool {
+	_, err := s.trie.Delete(key)
+	return err == nil
+}
+
+func (s *StringSet) Contains(key string) bool {
+	return s.trie.Contains(key)
+}
+
+func (s *StringSet) Len() int {
+	return s.trie.Len()
+}
+
+// Keys returns the members of the set in lexicographic order.
+func (s *StringSet) Keys() []string {
+	return s.trie.GetAll()
+}
+
+// Union returns a new set holding the members of s and other.
+func (s *StringSet) Union(other *StringSet) *StringSet {
+	union := &StringSet{
+		trie: trieFromRoot(cloneNode(s.trie.Root)),
+	}
+	// other's keys were accepted by a trie with the same options, so adding them can't fail
+	for _, key := range other.Keys() {
+		union.Add(key)
+	}
+	return union
+}
+
+// Intersection returns a new set holding the members of s which are also in other.
+func (s *StringSet) Intersection(other *StringSet) *StringSet {
+	return &StringSet{
+		trie: trieFromRoot(intersectNodes(s.trie.Root, other.trie.Root)),
+	}
+}
+
+// Difference returns a new set holding the members of s which are not in other.
+func (s *StringSet) Difference(other *StringSet) *StringSet {
+	return &StringSet{
+		trie: trieFromRoot(differenceNodes(s.trie.Root, other.trie.Root)),
+	}
+}
+
+// trieFromRoot returns a trie holding the nodes below root
+func trieFromRoot(root *Node[struct{}]) *Trie[struct{}] {
+	return &Trie[struct{}]{
+		Root:  root,
+		nodes: nodeCount(root) - 1,
+		keys:  keyCount(root),
+	}
+}
+
+// intersectNodes returns a new node holding the keys below both a and b
+func intersectNodes(a, b *Node[struct{}]) *Node[struct{}] {
+	node := &Node[struct{}]{
+		Children: []*Node[struct{}]{},
+		KeyRune:  a.KeyRune,
+		IsEnd:    a.IsEnd && b.IsEnd,
+	}
+	// children are sorted, so matching ones are found by merging the two lists
+	for i, j := 0, 0; i < len(a.Children) && j < len(b.Children); {
+		switch {
+		case a.Children[i].KeyRune < b.Children[j].KeyRune:
+			i++
+		case a.Children[i].KeyRune > b.Children[j].KeyRune:
+			j++
+		default:
+			if child := intersectNodes(a.Children[i], b.Children[j]); !prunable(child) {
+				node.Children = append(node.Children, child)
+			}
+			i++
+			j++
+		}
+	}
+	indexChildren(node)
+	return node
+}
+
+// differenceNodes returns a new node holding the keys below a which are not below b
+func differenceNodes(a, b *Node[struct{}]) *Node[struct{}] {
+	node := &Node[struct{}]{
+		Children: []*Node[struct{}]{},
+		KeyRune:  a.KeyRune,
+		IsEnd:    a.IsEnd && !b.IsEnd,
+	}
+	for _, aChild := range a.Children {
+		bChild := child(b, aChild.KeyRune)
+		if bChild == nil {
+			node.Children = append(node.Children, cloneNode(aChild))
+			continue
+		}
+		if c := differenceNodes(aChild, bChild); !prunable(c) {
+			node.Children = append(node.Children, c)
+		}
+	}
+	indexChildren(node)
+	return node
+}
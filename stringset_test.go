@@ -0,0 +1,69 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringSetAddRemove(t *testing.T) {
+	s, err := NewStringSet("go", "gopher", "go")
+	assert.Nil(t, err)
+	added, err := s.Add("golang")
+	assert.True(t, added)
+	assert.Nil(t, err)
+	added, err = s.Add("go")
+	assert.False(t, added)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, s.Len())
+	assert.True(t, s.Contains("go"))
+	assert.False(t, s.Contains("gop"))
+
+	assert.True(t, s.Remove("go"))
+	assert.False(t, s.Remove("go"))
+	assert.Equal(t, []string{"golang", "gopher"}, s.Keys())
+
+	added, err = s.Add("a\x00")
+	assert.False(t, added)
+	assert.ErrorIs(t, err, ErrInvalidRune)
+	s, err = NewStringSet("a", "b\x00")
+	assert.ErrorIs(t, err, ErrInvalidRune)
+	assert.Equal(t, []string{"a"}, s.Keys())
+}
+
+func TestStringSetAlgebra(t *testing.T) {
+	a, _ := NewStringSet("a", "ab", "abc", "b", "car", "cart")
+	b, _ := NewStringSet("ab", "abcd", "b", "ca", "cart", "z")
+
+	t.Run("union", func(t *testing.T) {
+		assert.Equal(t, []string{"a", "ab", "abc", "abcd", "b", "ca", "car", "cart", "z"}, a.Union(b).Keys())
+	})
+	t.Run("intersection", func(t *testing.T) {
+		i := a.Intersection(b)
+		assert.Equal(t, []string{"ab", "b", "cart"}, i.Keys())
+		assert.Equal(t, 0, countOrphans(i.trie.Root))
+		assert.Equal(t, i.Keys(), b.Intersection(a).Keys())
+	})
+	t.Run("difference", func(t *testing.T) {
+		d := a.Difference(b)
+		assert.Equal(t, []string{"a", "abc", "car"}, d.Keys())
+		assert.Equal(t, 0, countOrphans(d.trie.Root))
+		assert.Equal(t, []string{"abcd", "ca", "z"}, b.Difference(a).Keys())
+	})
+	t.Run("results are independent of the operands", func(t *testing.T) {
+		u := a.Union(b)
+		d := a.Difference(b)
+		u.Add("new")
+		d.Remove("a")
+		assert.False(t, a.Contains("new"))
+		assert.False(t, b.Contains("new"))
+		assert.True(t, a.Contains("a"))
+	})
+	t.Run("empty sets", func(t *testing.T) {
+		empty, _ := NewStringSet()
+		assert.Equal(t, a.Keys(), a.Union(empty).Keys())
+		assert.Equal(t, []string{}, a.Intersection(empty).Keys())
+		assert.Equal(t, a.Keys(), a.Difference(empty).Keys())
+		assert.Equal(t, []string{}, empty.Difference(a).Keys())
+	})
+}
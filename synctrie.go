@@ -0,0 +1,215 @@
+package trie
+
+import (
+	"slices"
+	"sync"
+)
+
+// SyncTrie is a Trie which is safe for concurrent use, guarded by a read-write lock.
+type SyncTrie[T any] struct {
+	mu   sync.RWMutex
+	trie *Trie[T]
+	// subscribers receive a ChangeEvent for every change, guarded by mu like the trie
+	subscribers []*subscriber[T]
+}
+
+// ChangeOp is the kind of change a ChangeEvent records
+type ChangeOp int
+
+const (
+	// ChangeInsert is a new key, with a zero Old value
+	ChangeInsert ChangeOp = iota
+	// ChangeSetValue is a new value for an existing key, from SetValue or a successful CompareAndSwap
+	ChangeSetValue
+	// ChangeDelete is a removed key, with a zero New value
+	ChangeDelete
+)
+
+// ChangeEvent records a change made to a SyncTrie, for change data capture.
+// Key is the key as the trie stores it, after options such as WithKeyNormalizer, so a replica applying
+// the events holds the same keys whichever spelling of them callers used.
+type ChangeEvent[T any] struct {
+	Op  ChangeOp
+	Key string
+	Old T
+	New T
+}
+
+type subscriber[T any] struct {
+	events  chan ChangeEvent[T]
+	dropped int
+}
+
+func NewSyncTrie[T any](opts ...Option[T]) *SyncTrie[T] {
+	return &SyncTrie[T]{
+		trie: NewTrieWithOptions(opts...),
+	}
+}
+
+func (s *SyncTrie[T]) Insert(key string, value T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.trie.Insert(key, value); err != nil {
+		return err
+	}
+	s.publish(ChangeEvent[T]{Op: ChangeInsert, Key: s.storedKey(key), New: value})
+	return nil
+}
+
+func (s *SyncTrie[T]) Search(key string) (T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Search(key)
+}
+
+func (s *SyncTrie[T]) Contains(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Contains(key)
+}
+
+func (s *SyncTrie[T]) Delete(key string) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, err := s.trie.Delete(key)
+	if err != nil {
+		return value, err
+	}
+	s.publish(ChangeEvent[T]{Op: ChangeDelete, Key: s.storedKey(key), Old: value})
+	return value, nil
+}
+
+func (s *SyncTrie[T]) SetValue(key string, value T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, _ := s.current(key)
+	if err := s.trie.SetValue(key, value); err != nil {
+		return err
+	}
+	s.publish(ChangeEvent[T]{Op: ChangeSetValue, Key: s.storedKey(key), Old: old, New: value})
+	return nil
+}
+
+// CompareAndSwap is like Trie.CompareAndSwap, with the comparison and swap done under the write lock.
+func (s *SyncTrie[T]) CompareAndSwap(key string, old, new T, eq func(a, b T) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.trie.CompareAndSwap(key, old, new, eq) {
+		return false
+	}
+	s.publish(ChangeEvent[T]{Op: ChangeSetValue, Key: s.storedKey(key), Old: old, New: new})
+	return true
+}
+
+// Increment is like Trie.Increment, with the read and the write of the value done under the write lock,
+// so concurrent increments of the same key are never lost.
+func (s *SyncTrie[T]) Increment(key string, delta T, add func(a, b T) T) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, existed := s.current(key)
+	value, err := s.trie.Increment(key, delta, add)
+	if err != nil {
+		return value, err
+	}
+	if existed {
+		s.publish(ChangeEvent[T]{Op: ChangeSetValue, Key: s.storedKey(key), Old: old, New: value})
+	} else {
+		s.publish(ChangeEvent[T]{Op: ChangeInsert, Key: s.storedKey(key), New: value})
+	}
+	return value, nil
+}
+
+// IncrementSafe adds delta to the count at key, inserting key with delta if it is not in the trie, and returns the new count.
+// Goroutines can share one trie to count words in parallel without locking of their own, see SyncTrie.Increment.
+// This is a function rather than a method since methods can't be limited to one type argument.
+func IncrementSafe(s *SyncTrie[int], key string, delta int) (int, error) {
+	return s.Increment(key, delta, func(a, b int) int { return a + b })
+}
+
+func (s *SyncTrie[T]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Len()
+}
+
+// Walk calls fn for every key like Trie.Walk, holding the read lock for the whole walk.
+// Writers are blocked until it returns, so fn should be quick, and must not call methods of s which write,
+// since they would wait for the lock forever. To do slow work on every key, iterate over SnapshotKeys instead.
+func (s *SyncTrie[T]) Walk(fn func(key string, value T) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Walk(fn)
+}
+
+// SnapshotKeys returns a copy of every key in lexicographic order.
+// The read lock is only held while copying, so the keys can be iterated without blocking writers,
+// at the cost of the copy. Keys may be deleted by other goroutines once it returns.
+func (s *SyncTrie[T]) SnapshotKeys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.GetAll()
+}
+
+// Subscribe returns a channel receiving a ChangeEvent for every change made from now on, in the order they were made,
+// and a function which unsubscribes and closes the channel. Events are sent while the write lock is held,
+// so rather than block writers on a slow subscriber, an event is dropped when the channel already holds size events.
+// Dropped reports how many were, so a subscriber can tell its view is incomplete and resync from SnapshotKeys.
+func (s *SyncTrie[T]) Subscribe(size int) (<-chan ChangeEvent[T], func()) {
+	sub := &subscriber[T]{events: make(chan ChangeEvent[T], size)}
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, sub)
+	s.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.subscribers = slices.DeleteFunc(s.subscribers, func(other *subscriber[T]) bool { return other == sub })
+			close(sub.events)
+		})
+	}
+	return sub.events, unsubscribe
+}
+
+// Dropped returns the number of events dropped because the channel returned by Subscribe was full.
+// It returns 0 once the channel is unsubscribed.
+func (s *SyncTrie[T]) Dropped(events <-chan ChangeEvent[T]) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sub := range s.subscribers {
+		if sub.events == events {
+			return sub.dropped
+		}
+	}
+	return 0
+}
+
+// current returns the value at key for a change event, without running the OnSearch hook,
+// since the caller didn't search for it
+func (s *SyncTrie[T]) current(key string) (T, bool) {
+	if ref, ok := s.trie.GetRef(key); ok {
+		return *ref, true
+	}
+	return *new(T), false
+}
+
+// storedKey returns key as the trie stores it, for a key the trie has just accepted
+func (s *SyncTrie[T]) storedKey(key string) string {
+	runes, err := s.trie.prepareKey([]rune(key))
+	if err != nil {
+		return key
+	}
+	return string(runes)
+}
+
+// publish sends event to every subscriber without blocking. The write lock must be held.
+func (s *SyncTrie[T]) publish(event ChangeEvent[T]) {
+	for _, sub := range s.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped++
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package trie
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTrie(t *testing.T) {
+	t.Run("operations", func(t *testing.T) {
+		trie := NewSyncTrie[int]()
+		assert.Nil(t, trie.Insert("a", 1))
+		assert.ErrorIs(t, trie.Insert("a", 2), ErrAlreadyExists)
+		assert.Nil(t, trie.SetValue("a", 2))
+		assert.True(t, trie.CompareAndSwap("a", 2, 3, func(a, b int) bool { return a == b }))
+		got, err := trie.Search("a")
+		assert.Nil(t, err)
+		assert.Equal(t, 3, got)
+		assert.True(t, trie.Contains("a"))
+		assert.Equal(t, 1, trie.Len())
+		_, err = trie.Delete("a")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{}, trie.SnapshotKeys())
+	})
+	t.Run("options", func(t *testing.T) {
+		trie := NewSyncTrie(WithMaxKeyLen[int](2))
+		assert.ErrorIs(t, trie.Insert("abc", 1), ErrKeyTooLong)
+	})
+	t.Run("writes don't run the OnSearch hook", func(t *testing.T) {
+		searches := 0
+		trie := NewSyncTrie(WithHooks[int](Hooks{OnSearch: func(string, bool) { searches++ }}))
+		assert.Nil(t, trie.Insert("a", 1))
+		assert.Nil(t, trie.SetValue("a", 2))
+		assert.ErrorIs(t, trie.SetValue("b", 2), ErrNotFound)
+		_, err := IncrementSafe(trie, "a", 1)
+		assert.Nil(t, err)
+		_, err = IncrementSafe(trie, "c", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, searches)
+		trie.Search("a")
+		assert.Equal(t, 1, searches)
+	})
+}
+
+func TestSyncTrieIncrement(t *testing.T) {
+	t.Run("parallel counts are exact", func(t *testing.T) {
+		trie := NewSyncTrie[int]()
+		words := []string{"the", "then", "they", "a", "an"}
+		workers, rounds := 8, 200
+		var wg sync.WaitGroup
+		for w := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range rounds {
+					// every worker counts every word, starting at a different one
+					word := words[(w+i)%len(words)]
+					_, err := IncrementSafe(trie, word, 1)
+					assert.Nil(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+		for _, word := range words {
+			got, err := trie.Search(word)
+			assert.Nil(t, err)
+			assert.Equal(t, workers*rounds/len(words), got, word)
+		}
+	})
+	t.Run("returns the new count", func(t *testing.T) {
+		trie := NewSyncTrie[int]()
+		got, err := IncrementSafe(trie, "a", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, got)
+		got, _ = IncrementSafe(trie, "a", -5)
+		assert.Equal(t, -3, got)
+
+		trie = NewSyncTrie(WithMaxKeyLen[int](1))
+		_, err = IncrementSafe(trie, "ab", 1)
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+	})
+	t.Run("publishes changes", func(t *testing.T) {
+		trie := NewSyncTrie[float64]()
+		events, unsubscribe := trie.Subscribe(2)
+		add := func(a, b float64) float64 { return a + b }
+		trie.Increment("x", 1.5, add)
+		trie.Increment("x", 1, add)
+		unsubscribe()
+		assert.Equal(t, ChangeEvent[float64]{Op: ChangeInsert, Key: "x", New: 1.5}, <-events)
+		assert.Equal(t, ChangeEvent[float64]{Op: ChangeSetValue, Key: "x", Old: 1.5, New: 2.5}, <-events)
+	})
+}
+
+func TestSyncTrieSubscribe(t *testing.T) {
+	eq := func(a, b int) bool { return a == b }
+
+	t.Run("events match the changes made", func(t *testing.T) {
+		trie := NewSyncTrie[int]()
+		trie.Insert("before", 0)
+		events, unsubscribe := trie.Subscribe(10)
+
+		trie.Insert("a", 1)
+		trie.Insert("a", 5) // already exists, no event
+		trie.SetValue("a", 2)
+		trie.SetValue("missing", 2)
+		trie.CompareAndSwap("a", 2, 3, eq)
+		trie.CompareAndSwap("a", 2, 4, eq) // not swapped, no event
+		trie.Delete("a")
+		trie.Delete("a")
+		unsubscribe()
+
+		got := []ChangeEvent[int]{}
+		for event := range events {
+			got = append(got, event)
+		}
+		assert.Equal(t, []ChangeEvent[int]{
+			{Op: ChangeInsert, Key: "a", New: 1},
+			{Op: ChangeSetValue, Key: "a", Old: 1, New: 2},
+			{Op: ChangeSetValue, Key: "a", Old: 2, New: 3},
+			{Op: ChangeDelete, Key: "a", Old: 3},
+		}, got)
+		// no longer subscribed, so changes don't panic sending on the closed channel
+		assert.Nil(t, trie.Insert("b", 1))
+		unsubscribe()
+	})
+	t.Run("full channel drops events instead of blocking", func(t *testing.T) {
+		trie := NewSyncTrie[int]()
+		events, unsubscribe := trie.Subscribe(2)
+		for i := range 5 {
+			assert.Nil(t, trie.Insert(fmt.Sprint(i), i))
+		}
+		assert.Equal(t, 3, trie.Dropped(events))
+		assert.Equal(t, ChangeEvent[int]{Op: ChangeInsert, Key: "0", New: 0}, <-events)
+		assert.Equal(t, ChangeEvent[int]{Op: ChangeInsert, Key: "1", New: 1}, <-events)
+
+		unsubscribe()
+		assert.Equal(t, 0, trie.Dropped(events))
+	})
+	t.Run("every subscriber receives every event", func(t *testing.T) {
+		trie := NewSyncTrie[int]()
+		first, unsubscribeFirst := trie.Subscribe(1)
+		second, unsubscribeSecond := trie.Subscribe(1)
+		defer unsubscribeSecond()
+		trie.Insert("a", 1)
+		unsubscribeFirst()
+		trie.Insert("b", 2)
+
+		assert.Equal(t, ChangeEvent[int]{Op: ChangeInsert, Key: "a", New: 1}, <-first)
+		_, open := <-first
+		assert.False(t, open)
+		assert.Equal(t, ChangeEvent[int]{Op: ChangeInsert, Key: "a", New: 1}, <-second)
+		assert.Equal(t, 1, trie.Dropped(second))
+	})
+	t.Run("events carry the stored key", func(t *testing.T) {
+		trie := NewSyncTrie(WithKeyNormalizer[int](strings.ToLower))
+		events, unsubscribe := trie.Subscribe(10)
+		trie.Insert("Hello", 1)
+		trie.SetValue("HeLLo", 2)
+		trie.CompareAndSwap("hELLO", 2, 3, eq)
+		trie.Increment("HELLO", 1, func(a, b int) int { return a + b })
+		trie.Delete("HELLO")
+		unsubscribe()
+
+		keys := []string{}
+		for event := range events {
+			keys = append(keys, event.Key)
+		}
+		assert.Equal(t, []string{"hello", "hello", "hello", "hello", "hello"}, keys)
+	})
+}
+
+func TestSyncTrieConcurrentIteration(t *testing.T) {
+	trie := NewSyncTrie[int]()
+	for i := 0; i < 100; i++ {
+		trie.Insert(fmt.Sprintf("seed%d", i), i)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("w%d-%d", w, i)
+				trie.Insert(key, i)
+				trie.CompareAndSwap(key, i, -i, func(a, b int) bool { return a == b })
+				if i%2 == 0 {
+					trie.Delete(key)
+				}
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				trie.Walk(func(key string, value int) error {
+					return nil
+				})
+				// snapshot keys may be deleted by now, so only the seeds are sure to be found
+				for _, key := range trie.SnapshotKeys() {
+					trie.Contains(key)
+				}
+				_, err := trie.Search("seed1")
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the seeds plus the odd keys of every writer
+	assert.Equal(t, 100+4*100, trie.Len())
+	assert.Equal(t, trie.Len(), len(trie.SnapshotKeys()))
+}
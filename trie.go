@@ -1,174 +1,2922 @@
 package trie
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"log/slog"
+	"hash/fnv"
+	"io"
+	"iter"
+	"maps"
+	"math"
+	"math/rand/v2"
 	"slices"
 	"strings"
+	"unicode/utf8"
+	"unsafe"
 )
 
 var (
 	ErrAlreadyExists = errors.New("val already exists in trie")
 	ErrNotFound      = errors.New("key not found in trie")
+	ErrKeyTooLong    = errors.New("key exceeds max key length")
+	ErrInvalidRune   = errors.New("key contains a rune outside the allowed alphabet")
+	ErrCorruptTrie   = errors.New("trie is corrupt")
+	ErrTrieFull      = errors.New("trie has reached its max number of nodes")
+	// ErrPrefixConflict is wrapped in an error naming the existing key, see WithStrictDisjoint
+	ErrPrefixConflict = errors.New("key is a prefix of or prefixed by the existing key")
+	// ErrMinimized is returned by methods which would change a trie made read-only by Minimize
+	ErrMinimized = errors.New("trie is minimized and read-only")
 )
 
+// errStopWalk is returned by walk callbacks to end the walk early, and is never returned to callers
+var errStopWalk = errors.New("stop walk")
+
+// KeyError records the key an operation failed on.
+// Methods taking a key wrap their errors in a *KeyError, so callers can still test the cause with errors.Is,
+// and get the key with errors.As.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Err, e.Key)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// keyError wraps err in a *KeyError for key, unless err is nil
+func keyError(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &KeyError{Key: key, Err: err}
+}
+
 type Trie[T any] struct {
 	Root *Node[T]
+	// maxKeyLen is the maximum number of runes in a key, 0 means no limit
+	maxKeyLen int
+	// maxNodes is the maximum number of nodes below the root, 0 means no limit
+	maxNodes int
+	// skipRunes are dropped from keys before use, see WithSkipRunes
+	skipRunes []rune
+	// storeKeys keeps each key on its end node, see WithStoredKeys
+	storeKeys bool
+	// disjoint rejects keys which are a prefix of another key, see WithStrictDisjoint
+	disjoint bool
+	// fanout is the number of children reserved for a node when it gets its first one, 0 leaves it to append
+	fanout int
+	// hooks are run after inserts, searches and deletes
+	hooks Hooks
+	// nodes is the number of nodes below the root, kept up to date by every method which adds or removes nodes
+	nodes int
+	// keys is the number of keys, kept up to date like nodes
+	keys int
+	// normalize is applied to every key before use, if set
+	normalize func(string) string
+	// seq is the sequence number given to the last inserted key
+	seq uint64
+	// allowRune reports whether a rune may be used in a key, if set
+	allowRune func(rune) bool
+	// merge combines the values of a key inserted twice, if set
+	merge func(existing, incoming T) T
+	// prefixValues holds the values set by SetPrefixValue, keyed by prefix
+	prefixValues *Trie[T]
+	// compareValues orders values for KeysByValue, if set
+	compareValues func(a, b T) int
+	// interner holds the shared copy of every distinct value, if set
+	interner *interner[T]
+	// minimized is set by Minimize, after which nodes may be shared by several keys and must not be changed
+	minimized bool
+}
+
+// Option configures a trie created by NewTrieWithOptions
+type Option[T any] func(*Trie[T])
+
+// WithMaxKeyLen rejects keys longer than n runes with ErrKeyTooLong, before doing any work on them.
+// This protects against huge keys from untrusted input.
+func WithMaxKeyLen[T any](n int) Option[T] {
+	return func(t *Trie[T]) {
+		t.maxKeyLen = n
+	}
+}
+
+// WithFanout makes nodes reserve room for n children when they get their first child, rather than
+// growing their children as they are added. When most nodes have around n children, such as with keys
+// over a small alphabet, this saves reallocating children during bulk loads, at the cost of unused room
+// in nodes with fewer children.
+func WithFanout[T any](n int) Option[T] {
+	return func(t *Trie[T]) {
+		t.fanout = n
+	}
+}
+
+// WithStoredKeys keeps a copy of every key on the node it ends at, so GetAll, Walk and the other traversals
+// built on them return it directly rather than building a new string from the runes on the way down.
+// This trades memory for speed in read-heavy use: each key is held once more, on top of its nodes,
+// in exchange for an allocation less per key visited.
+func WithStoredKeys[T any]() Option[T] {
+	return func(t *Trie[T]) {
+		t.storeKeys = true
+	}
+}
+
+// WithStrictDisjoint makes inserts reject a key which is a prefix of an existing key, or has one as a prefix,
+// with an error wrapping ErrPrefixConflict which names the existing key. Routes such as "/api" and "/api/v1"
+// can then not both be stored by mistake. The check is done before any nodes are created, and applies to Rename too.
+func WithStrictDisjoint[T any]() Option[T] {
+	return func(t *Trie[T]) {
+		t.disjoint = true
+	}
+}
+
+// Hooks are callbacks run after inserts, searches and deletes, for example to count hits and misses:
+//   - OnInsert after Insert and InsertRunes, and for every line LoadLines inserts
+//   - OnSearch after Search and SearchRunes, and GetOrDefault and Resolve, which search first
+//   - OnDelete after Delete and DeleteRunes, and for every key DeleteAll deletes
+//
+// Other methods don't run them, even those which insert, read or delete keys such as InsertOrGet, SetValue,
+// Increment, Contains, GetRef or DeleteIf. Each receives the key as given by the caller, and whether the key
+// was inserted, found or deleted. Nil callbacks are skipped. They run on the caller's goroutine, so must be quick.
+type Hooks struct {
+	OnInsert func(key string, inserted bool)
+	OnSearch func(key string, found bool)
+	OnDelete func(key string, deleted bool)
+}
+
+// WithHooks runs hooks after the operations they are for, see Hooks.
+func WithHooks[T any](hooks Hooks) Option[T] {
+	return func(t *Trie[T]) {
+		t.hooks = hooks
+	}
+}
+
+// WithMaxNodes makes inserts which would take the trie past n nodes below the root fail with ErrTrieFull,
+// without inserting anything. Deleting keys frees their nodes for later inserts.
+// This bounds the memory used by a trie filled from untrusted input.
+func WithMaxNodes[T any](n int) Option[T] {
+	return func(t *Trie[T]) {
+		t.maxNodes = n
+	}
+}
+
+// WithKeyNormalizer applies normalize to every key given to Insert, Search, Delete and the other methods taking a key,
+// and to the prefixes, queries and bounds given to methods such as PrefixSearch, FuzzySearch and KeysInRange,
+// so keys which normalize to the same string are treated as the same key. Glob and class patterns are not normalized,
+// since normalize could change their escapes; their literal runes should already be normalized.
+// For example, pass norm.NFC.String from golang.org/x/text/unicode/norm to treat composed and decomposed
+// forms of a character as equal. Taking a function keeps that dependency out of this package.
+func WithKeyNormalizer[T any](normalize func(string) string) Option[T] {
+	return func(t *Trie[T]) {
+		t.normalize = normalize
+	}
+}
+
+// WithSkipRunes drops every rune in skip from keys, after normalization, so that with '-' and ' ' skipped,
+// "co-operate" and "co operate" are the same key as "cooperate". It applies wherever WithKeyNormalizer does,
+// and skipped runes are also dropped from the literal runes of glob and class patterns.
+// Keys are stored without the skipped runes, so those are the keys returned by GetAll and the like.
+func WithSkipRunes[T any](skip ...rune) Option[T] {
+	return func(t *Trie[T]) {
+		t.skipRunes = skip
+	}
+}
+
+// WithAllowedRunes rejects keys containing a rune for which allow returns false with ErrInvalidRune,
+// before any nodes are created. Keys are checked after normalization.
+// For example, pass unicode.IsLower to only store lowercase keys.
+func WithAllowedRunes[T any](allow func(rune) bool) Option[T] {
+	return func(t *Trie[T]) {
+		t.allowRune = allow
+	}
+}
+
+// WithMerge makes Insert of an existing key store merge(existing, incoming) instead of returning ErrAlreadyExists.
+// The key keeps its sequence number, since it is not new.
+func WithMerge[T any](merge func(existing, incoming T) T) Option[T] {
+	return func(t *Trie[T]) {
+		t.merge = merge
+	}
+}
+
+// WithValueCompare sets the function used to order values, for ranking keys by value with KeysByValue.
+// It returns a negative number when a < b, zero when equal and a positive number when a > b, like cmp.Compare.
+func WithValueCompare[T any](compare func(a, b T) int) Option[T] {
+	return func(t *Trie[T]) {
+		t.compareValues = compare
+	}
+}
+
+// WithInterning makes the trie keep one shared copy of each distinct value, where values are distinct by eq,
+// and store that copy for every key inserted with an equal value. This saves memory when many keys hold equal values
+// of a type which refers to its contents, such as strings or slices, since they all share one copy of the contents.
+// Values are interned by Insert, SetValue and CompareAndSwap. hash must return equal hashes for equal values.
+// Interned values are kept for the life of the trie, even once no key holds them, so Increment leaves its sums
+// uninterned: every count a counter passed through would be kept. Copies such as Clone get their own copy of
+// the interned values, so they can be changed independently.
+func WithInterning[T any](hash func(T) uint64, eq func(a, b T) bool) Option[T] {
+	return func(t *Trie[T]) {
+		t.interner = &interner[T]{hash: hash, eq: eq, values: map[uint64][]T{}}
+	}
+}
+
+// interner keeps the values of a trie with WithInterning, bucketed by hash
+type interner[T any] struct {
+	hash   func(T) uint64
+	eq     func(a, b T) bool
+	values map[uint64][]T
+}
+
+// clone returns a copy of in which can be changed independently, or nil if in is nil
+func (in *interner[T]) clone() *interner[T] {
+	if in == nil {
+		return nil
+	}
+	values := make(map[uint64][]T, len(in.values))
+	for h, kept := range in.values {
+		values[h] = slices.Clone(kept)
+	}
+	return &interner[T]{hash: in.hash, eq: in.eq, values: values}
+}
+
+// intern returns the kept value equal to value, keeping value if there is none
+func (in *interner[T]) intern(value T) T {
+	h := in.hash(value)
+	for _, kept := range in.values[h] {
+		if in.eq(kept, value) {
+			return kept
+		}
+	}
+	in.values[h] = append(in.values[h], value)
+	return value
+}
+
+// intern returns the shared copy of value if the trie interns values, and value otherwise
+func (t *Trie[T]) intern(value T) T {
+	if t.interner == nil {
+		return value
+	}
+	return t.interner.intern(value)
+}
+
+type Node[T any] struct {
+	Value T
+	// Children are kept sorted by KeyRune.
+	// They should only be modified by the trie, since nodes with many children also index them in childMap.
+	Children []*Node[T]
+	KeyRune  rune
+	IsEnd    bool
+	// softDeleted marks a key removed by SoftDelete, which Undelete can restore
+	softDeleted bool
+	// seq is the sequence number of the key ending at this node, see Trie.Sequence
+	seq uint64
+	// key is the key ending at this node, if the trie stores keys, see WithStoredKeys
+	key string
+	// childMap indexes Children by KeyRune once there are at least childMapThreshold of them
+	childMap map[rune]*Node[T]
+}
+
+// childMapThreshold is the number of children at which a node indexes them in a map.
+// Binary searching a few children is cheap and most nodes only have one or two, so a map per node would waste memory.
+// The map is dropped again below half the threshold, so a node on the boundary doesn't keep rebuilding it.
+const childMapThreshold = 32
+
+func (n Node[T]) String() string {
+	var s strings.Builder
+	for i := range n.Children {
+		s.WriteRune(n.Children[i].KeyRune)
+		s.WriteString(", ")
+	}
+	return fmt.Sprintf("key='%s' val='%v' Children='%s'", string(n.KeyRune), n.Value, s.String())
+}
+
+func (t Trie[T]) String() string {
+	return fmt.Sprintf("\n%s\n", PrintTrie(t.Root, "", 0, true))
+}
+
+func NewTrie[T any]() *Trie[T] {
+	return &Trie[T]{
+		Root: &Node[T]{},
+	}
+}
+
+func NewTrieWithOptions[T any](opts ...Option[T]) *Trie[T] {
+	t := NewTrie[T]()
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewTrieWithMerge returns a trie which merges values on duplicate inserts, see WithMerge.
+func NewTrieWithMerge[T any](merge func(existing, incoming T) T) *Trie[T] {
+	return NewTrieWithOptions(WithMerge(merge))
+}
+
+// NewTrieInterned returns a trie which keeps one shared copy of each distinct value, see WithInterning.
+func NewTrieInterned[T any](hash func(T) uint64, eq func(a, b T) bool) *Trie[T] {
+	return NewTrieWithOptions(WithInterning(hash, eq))
+}
+
+// NewTrieWithFanout returns a trie whose nodes reserve room for n children, see WithFanout.
+func NewTrieWithFanout[T any](n int) *Trie[T] {
+	return NewTrieWithOptions(WithFanout[T](n))
+}
+
+// NewTrieStoringKeys returns a trie which keeps every key on its end node, see WithStoredKeys.
+func NewTrieStoringKeys[T any]() *Trie[T] {
+	return NewTrieWithOptions(WithStoredKeys[T]())
+}
+
+// NewTrieFromMap builds a trie holding every key and value in m.
+// Map keys are unique, so an error is only returned if an insert fails unexpectedly; all such errors are joined.
+// Each is a *KeyError holding the key that failed.
+func NewTrieFromMap[T any](m map[string]T) (*Trie[T], error) {
+	t := NewTrie[T]()
+	var errs []error
+	for key, value := range m {
+		if err := t.Insert(key, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return t, errors.Join(errs...)
+}
+
+// Operations
+
+func (t *Trie[T]) Insert(key string, value T) error {
+	// prefix conflicts are only checked on the rune path, like node limits
+	if !t.asciiKey(key) || t.disjoint {
+		return t.InsertRunes([]rune(key), value)
+	}
+	if err := t.checkASCIIKey(key); err != nil {
+		return t.insertHook(key, keyError(key, err))
+	}
+	node, created, err := insertASCII(t.Root, key, value, t.fanout)
+	t.nodes += created
+	if node, err = t.finishInsert(node, value, err); err == nil && t.storeKeys {
+		node.key = key
+	}
+	return t.insertHook(key, keyError(key, err))
+}
+
+// InsertRunes is like Insert but takes the key as runes, avoiding a conversion when the caller already has them.
+func (t *Trie[T]) InsertRunes(key []rune, value T) error {
+	prepared, err := t.prepareWrite(key)
+	if err != nil {
+		return t.insertHook(string(key), keyError(string(key), err))
+	}
+	_, err = t.insertKey(prepared, value)
+	return t.insertHook(string(key), keyError(string(key), err))
+}
+
+// insertHook runs the OnInsert hook for the result of inserting key, and returns err
+func (t *Trie[T]) insertHook(key string, err error) error {
+	if t.hooks.OnInsert != nil {
+		t.hooks.OnInsert(key, err == nil)
+	}
+	return err
+}
+
+// insertKey inserts an already prepared key and returns its end node
+func (t *Trie[T]) insertKey(key []rune, value T) (*Node[T], error) {
+	if t.minimized {
+		return nil, ErrMinimized
+	}
+	if err := t.checkCapacity(key); err != nil {
+		return nil, err
+	}
+	if err := t.checkDisjoint(key, nil); err != nil {
+		return nil, err
+	}
+	node, created, err := insert(t.Root, key, value, t.fanout)
+	t.nodes += created
+	if node, err = t.finishInsert(node, value, err); err == nil && t.storeKeys {
+		node.key = string(key)
+	}
+	return node, err
+}
+
+// checkDisjoint returns an error wrapping ErrPrefixConflict if the trie keeps keys disjoint and key is a prefix of
+// another key or has one as a prefix. The key ending at ignore doesn't count, for a key about to be moved.
+// Inserting key itself again is not a conflict, and is left to insert.
+func (t *Trie[T]) checkDisjoint(key []rune, ignore *Node[T]) error {
+	if !t.disjoint {
+		return nil
+	}
+	isKey := func(node *Node[T]) bool {
+		return node.IsEnd && node != ignore
+	}
+	node := t.Root
+	for i, r := range key {
+		if isKey(node) {
+			return fmt.Errorf("%w %q", ErrPrefixConflict, string(key[:i]))
+		}
+		if node = child(node, r); node == nil {
+			return nil
+		}
+	}
+	conflict := ""
+	found := false
+	walkChildren(node.Children, key, func(keys []rune, node *Node[T]) error {
+		if isKey(node) {
+			conflict, found = nodeKey(node, keys), true
+			return errStopWalk
+		}
+		return nil
+	})
+	if found {
+		return fmt.Errorf("%w %q", ErrPrefixConflict, conflict)
+	}
+	return nil
+}
+
+// checkCapacity returns ErrTrieFull if inserting key would take the trie past its max number of nodes
+func (t *Trie[T]) checkCapacity(key []rune) error {
+	if t.maxNodes <= 0 {
+		return nil
+	}
+	node := t.Root
+	missing := len(key)
+	for _, r := range key {
+		if node = child(node, r); node == nil {
+			break
+		}
+		missing--
+	}
+	if t.nodes+missing > t.maxNodes {
+		return ErrTrieFull
+	}
+	return nil
+}
+
+// finishInsert takes the result of inserting value, and assigns the sequence number of a new key,
+// or merges value into an existing key if the trie has a merge function
+func (t *Trie[T]) finishInsert(node *Node[T], value T, err error) (*Node[T], error) {
+	if err == ErrAlreadyExists && t.merge != nil {
+		node.Value = t.intern(t.merge(node.Value, value))
+		return node, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	node.Value = t.intern(node.Value)
+	t.keys++
+	t.seq++
+	node.seq = t.seq
+	return node, nil
+}
+
+// InsertReport is like Insert but also returns how many leading runes of key were already in the trie as a prefix,
+// and how many nodes were created for the rest. Together they add up to the length of key in runes,
+// and an existing key shares all of its runes.
+func (t *Trie[T]) InsertReport(key string, value T) (sharedPrefixLen int, newNodes int, err error) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return 0, 0, keyError(key, err)
+	}
+	before := t.nodes
+	_, err = t.insertKey(runes, value)
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return 0, 0, keyError(key, err)
+	}
+	newNodes = t.nodes - before
+	return len(runes) - newNodes, newNodes, keyError(key, err)
+}
+
+// InsertFunc inserts the value returned by factory at key, and returns it.
+// factory is only called if key is new, otherwise InsertFunc returns ErrAlreadyExists without building a value.
+func (t *Trie[T]) InsertFunc(key string, factory func() T) (T, error) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return *new(T), keyError(key, err)
+	}
+	if node := search(t.Root, runes); node != nil && node.IsEnd {
+		return *new(T), keyError(key, ErrAlreadyExists)
+	}
+	value := factory()
+	if _, err := t.insertKey(runes, value); err != nil {
+		return *new(T), keyError(key, err)
+	}
+	return value, nil
+}
+
+// InsertOrGet returns the value stored at key and true if key exists, without overwriting it.
+// Otherwise it stores value and returns it with false, like sync.Map's LoadOrStore.
+// A key rejected by the trie's options, such as one longer than WithMaxKeyLen, is not stored and returns the zero value and false.
+func (t *Trie[T]) InsertOrGet(key string, value T) (actual T, loaded bool) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return *new(T), false
+	}
+	if node := search(t.Root, runes); node != nil && node.IsEnd {
+		return node.Value, true
+	}
+	if _, err := t.insertKey(runes, value); err != nil {
+		return *new(T), false
+	}
+	return value, false
+}
+
+// GetOrDefault returns the value stored at key, or def if key is not in the trie.
+func (t *Trie[T]) GetOrDefault(key string, def T) T {
+	value, err := t.Search(key)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// SetValue overwrites the value of an existing key without changing the trie's structure.
+// Unlike Insert it never creates the key, and returns ErrNotFound if key is not in the trie.
+func (t *Trie[T]) SetValue(key string, value T) error {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return keyError(key, err)
+	}
+	node := search(t.Root, runes)
+	if node == nil || !node.IsEnd {
+		return keyError(key, ErrNotFound)
+	}
+	node.Value = t.intern(value)
+	return nil
+}
+
+// CompareAndSwap replaces the value at key with new only if the current value equals old according to eq,
+// and reports whether it did. It returns false if key is not in the trie, or the trie is minimized.
+// The trie is not safe for concurrent use, so callers sharing it must hold a write lock around the call.
+func (t *Trie[T]) CompareAndSwap(key string, old, new T, eq func(a, b T) bool) (swapped bool) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return false
+	}
+	node := search(t.Root, runes)
+	if node == nil || !node.IsEnd || !eq(node.Value, old) {
+		return false
+	}
+	node.Value = t.intern(new)
+	return true
+}
+
+// Increment adds delta to the value at key using add, and returns the new value.
+// If key is not in the trie it is inserted with delta as its value.
+func (t *Trie[T]) Increment(key string, delta T, add func(a, b T) T) (T, error) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return *new(T), keyError(key, err)
+	}
+	node := search(t.Root, runes)
+	if node != nil && node.IsEnd {
+		node.Value = add(node.Value, delta)
+		return node.Value, nil
+	}
+	if _, err := t.insertKey(runes, delta); err != nil {
+		return *new(T), keyError(key, err)
+	}
+	return delta, nil
+}
+
+// LoadLines inserts every line read from r, with surrounding whitespace trimmed, under the value returned by value,
+// and returns how many keys were inserted. Lines are read one at a time, so r can be larger than memory.
+// Blank lines and keys already in the trie are skipped. Other insert failures don't stop the load;
+// they are joined with any read error and returned, each as a *KeyError holding the key that failed.
+func (t *Trie[T]) LoadLines(r io.Reader, value func(key string) T) (count int, err error) {
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" {
+			continue
+		}
+		err := t.Insert(key, value(key))
+		switch {
+		case err == nil:
+			count++
+		case !errors.Is(err, ErrAlreadyExists):
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, scanner.Err())
+	return count, errors.Join(errs...)
+}
+
+// asciiKey reports whether key can take the ASCII fast path, which walks the key's bytes instead of converting it to runes.
+// An ASCII byte is the same as its rune, so the path through the trie is the same either way.
+// Keys are only fast if there is no normalizer or runes to skip, since they could turn them into other keys,
+// no node limit, which is checked on the rune path, and the trie is not minimized, which writes check on the rune path.
+func (t *Trie[T]) asciiKey(key string) bool {
+	if t.normalize != nil || t.maxNodes > 0 || len(t.skipRunes) > 0 || t.minimized {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// checkASCIIKey validates an ASCII key according to the trie's options, like prepareKey
+func (t *Trie[T]) checkASCIIKey(key string) error {
+	if t.maxKeyLen > 0 && len(key) > t.maxKeyLen {
+		return ErrKeyTooLong
+	}
+	if strings.IndexByte(key, 0) >= 0 {
+		return ErrInvalidRune
+	}
+	if t.allowRune != nil {
+		for i := 0; i < len(key); i++ {
+			if !t.allowRune(rune(key[i])) {
+				return ErrInvalidRune
+			}
+		}
+	}
+	return nil
+}
+
+// prepareKey normalizes and validates key according to the trie's options.
+// Keys containing the NUL rune are always rejected with ErrInvalidRune, since KeyRune 0 marks the root:
+// Validate would report such a node as corrupt and Pretty would leave it out.
+func (t *Trie[T]) prepareKey(key []rune) ([]rune, error) {
+	if t.normalize != nil {
+		key = []rune(t.normalize(string(key)))
+	}
+	key = t.dropSkipRunes(key)
+	if t.maxKeyLen > 0 && len(key) > t.maxKeyLen {
+		return nil, ErrKeyTooLong
+	}
+	if slices.Contains(key, 0) {
+		return nil, ErrInvalidRune
+	}
+	if t.allowRune != nil && slices.ContainsFunc(key, func(r rune) bool { return !t.allowRune(r) }) {
+		return nil, ErrInvalidRune
+	}
+	return key, nil
+}
+
+// preparePrefix normalizes prefix and drops skipped runes like prepareKey, for methods taking a prefix, query or bound rather than a key.
+// It rejects nothing, since a prefix no key can have simply matches no keys.
+func (t *Trie[T]) preparePrefix(prefix string) []rune {
+	if t.normalize != nil {
+		prefix = t.normalize(prefix)
+	}
+	return t.dropSkipRunes([]rune(prefix))
+}
+
+// prepareWrite is like prepareKey for methods which change the trie, which also fail with ErrMinimized once it is minimized
+func (t *Trie[T]) prepareWrite(key []rune) ([]rune, error) {
+	if t.minimized {
+		return nil, ErrMinimized
+	}
+	return t.prepareKey(key)
+}
+
+// dropSkipRunes returns key without the runes set by WithSkipRunes, leaving key itself untouched
+func (t *Trie[T]) dropSkipRunes(key []rune) []rune {
+	if len(t.skipRunes) == 0 || !slices.ContainsFunc(key, t.skipRune) {
+		return key
+	}
+	return slices.DeleteFunc(slices.Clone(key), t.skipRune)
+}
+
+func (t *Trie[T]) skipRune(r rune) bool {
+	return slices.Contains(t.skipRunes, r)
+}
+
+// insert adds key below node and returns the new end node, or the existing one along with ErrAlreadyExists.
+// It also returns the number of nodes created. Nodes given their first child reserve room for fanout children.
+func insert[T any](node *Node[T], key []rune, value T, fanout int) (*Node[T], int, error) {
+	created := 0
+	for _, r := range key {
+		next := child(node, r)
+		if next == nil {
+			i, _ := childIndex(node, r)
+			next = &Node[T]{
+				Children: []*Node[T]{},
+				KeyRune:  r,
+			}
+			reserveChildren(node, fanout)
+			insertChild(node, i, next)
+			created++
+		}
+		node = next
+	}
+	if node.IsEnd {
+		return node, created, ErrAlreadyExists
+	}
+	node.IsEnd = true
+	node.softDeleted = false
+	node.Value = value
+	return node, created, nil
+}
+
+// reserveChildren gives node room for fanout children if it has no room for any yet.
+// This is left until a node gets its first child, so leaves don't allocate for children they never have.
+func reserveChildren[T any](node *Node[T], fanout int) {
+	if fanout > 0 && cap(node.Children) == 0 {
+		node.Children = make([]*Node[T], 0, fanout)
+	}
+}
+
+// insertASCII is like insert for an ASCII key
+func insertASCII[T any](node *Node[T], key string, value T, fanout int) (*Node[T], int, error) {
+	created := 0
+	for i := 0; i < len(key); i++ {
+		r := rune(key[i])
+		next := child(node, r)
+		if next == nil {
+			j, _ := childIndex(node, r)
+			next = &Node[T]{
+				Children: []*Node[T]{},
+				KeyRune:  r,
+			}
+			reserveChildren(node, fanout)
+			insertChild(node, j, next)
+			created++
+		}
+		node = next
+	}
+	if node.IsEnd {
+		return node, created, ErrAlreadyExists
+	}
+	node.IsEnd = true
+	node.softDeleted = false
+	node.Value = value
+	return node, created, nil
+}
+
+// childIndex binary searches node's children for the child with KeyRune r.
+// It returns the child's index and true, or the index r would be inserted at and false.
+func childIndex[T any](node *Node[T], r rune) (int, bool) {
+	return slices.BinarySearchFunc(node.Children, r, func(child *Node[T], r rune) int {
+		return cmp.Compare(child.KeyRune, r)
+	})
+}
+
+// child returns node's child with KeyRune r, or nil if there is none
+func child[T any](node *Node[T], r rune) *Node[T] {
+	if node.childMap != nil {
+		return node.childMap[r]
+	}
+	if i, found := childIndex(node, r); found {
+		return node.Children[i]
+	}
+	return nil
+}
+
+// insertChild inserts newChild into node's children at index i
+func insertChild[T any](node *Node[T], i int, newChild *Node[T]) {
+	node.Children = slices.Insert(node.Children, i, newChild)
+	if node.childMap != nil {
+		node.childMap[newChild.KeyRune] = newChild
+		return
+	}
+	indexChildren(node)
+}
+
+// removeChild removes the child at index i from node's children
+func removeChild[T any](node *Node[T], i int) {
+	if node.childMap != nil {
+		delete(node.childMap, node.Children[i].KeyRune)
+	}
+	node.Children[i] = nil
+	node.Children = slices.Delete(node.Children, i, i+1)
+	if len(node.Children) < childMapThreshold/2 {
+		node.childMap = nil
+	}
+}
+
+// indexChildren builds or drops node's childMap to match its number of children
+func indexChildren[T any](node *Node[T]) {
+	switch {
+	case len(node.Children) < childMapThreshold/2:
+		node.childMap = nil
+	case len(node.Children) >= childMapThreshold || node.childMap != nil:
+		node.childMap = make(map[rune]*Node[T], len(node.Children))
+		for _, c := range node.Children {
+			node.childMap[c.KeyRune] = c
+		}
+	}
+}
+
+func (t *Trie[T]) Search(key string) (T, error) {
+	if !t.asciiKey(key) {
+		return t.SearchRunes([]rune(key))
+	}
+	if err := t.checkASCIIKey(key); err != nil {
+		return t.searchHook(key, *new(T), keyError(key, err))
+	}
+	node := searchASCII(t.Root, key)
+	if node == nil || !node.IsEnd {
+		return t.searchHook(key, *new(T), keyError(key, ErrNotFound))
+	}
+	return t.searchHook(key, node.Value, nil)
+}
+
+// SearchRunes is like Search but takes the key as runes.
+func (t *Trie[T]) SearchRunes(key []rune) (T, error) {
+	prepared, err := t.prepareKey(key)
+	if err != nil {
+		return t.searchHook(string(key), *new(T), keyError(string(key), err))
+	}
+	node := search(t.Root, prepared)
+	if node == nil || !node.IsEnd {
+		return t.searchHook(string(key), *new(T), keyError(string(key), ErrNotFound))
+	}
+	return t.searchHook(string(key), node.Value, nil)
+}
+
+// searchHook runs the OnSearch hook for the result of searching for key, and returns value and err
+func (t *Trie[T]) searchHook(key string, value T, err error) (T, error) {
+	if t.hooks.OnSearch != nil {
+		t.hooks.OnSearch(key, err == nil)
+	}
+	return value, err
+}
+
+// GetRef returns a pointer to the value stored at key, so it can be changed in place, and false if key is not in the trie.
+// The pointer is to the field of key's node, so it is only valid until key is deleted: Delete zeroes the value,
+// and once the node is gone writes through it are lost, or land on the same key if it is inserted again at a node
+// which was kept. Writes also skip anything the trie does when storing values, such as WithInterning,
+// and change every key sharing the node in a trie made read-only by Minimize. It does not run the OnSearch hook.
+func (t *Trie[T]) GetRef(key string) (*T, bool) {
+	runes, err := t.prepareKey([]rune(key))
+	if err != nil {
+		return nil, false
+	}
+	node := search(t.Root, runes)
+	if node == nil || !node.IsEnd {
+		return nil, false
+	}
+	return &node.Value, true
+}
+
+// SearchLenient returns the value at the node reached by key, and false if no node lies on key's path.
+// Unlike Search it ignores whether the node ends a key, so a prefix of stored keys is found too,
+// with the zero value unless one was set on its node, for example through NodeAt.
+func (t *Trie[T]) SearchLenient(key string) (T, bool) {
+	runes, err := t.prepareKey([]rune(key))
+	if err != nil {
+		return *new(T), false
+	}
+	node := search(t.Root, runes)
+	if node == nil {
+		return *new(T), false
+	}
+	return node.Value, true
+}
+
+// Sequence returns the sequence number assigned to key when it was inserted, and false if key is not in the trie.
+// Every successful insert is given a number greater than all before it, so they record insertion order.
+// A minimized trie has no sequence numbers, since keys sharing a node would share its number.
+func (t *Trie[T]) Sequence(key string) (uint64, bool) {
+	runes, err := t.prepareKey([]rune(key))
+	if err != nil || t.minimized {
+		return 0, false
+	}
+	node := search(t.Root, runes)
+	if node == nil || !node.IsEnd {
+		return 0, false
+	}
+	return node.seq, true
+}
+
+// Contains reports whether key is stored in the trie.
+func (t *Trie[T]) Contains(key string) bool {
+	runes, err := t.prepareKey([]rune(key))
+	if err != nil {
+		return false
+	}
+	node := search(t.Root, runes)
+	return node != nil && node.IsEnd
+}
+
+// DryRunInsert reports, without changing the trie, which of keys inserting them in order would add and which would
+// be duplicates, either of a key already in the trie or of one earlier in keys. With WithMerge duplicates are merged
+// rather than rejected. Keys rejected by the trie's options, such as ones over WithMaxKeyLen or conflicting with
+// another key under WithStrictDisjoint, are in neither, while keys which would take the trie past WithMaxNodes
+// are still counted as added.
+func (t *Trie[T]) DryRunInsert(keys []string) (added []string, duplicates []string) {
+	added, duplicates = []string{}, []string{}
+	// batch holds the prepared keys added so far, which normalization may have made equal to other keys,
+	// in a trie of its own so conflicts with them can be checked like conflicts with t's keys
+	batch := NewTrie[struct{}]()
+	batch.disjoint = t.disjoint
+	for _, key := range keys {
+		runes, err := t.prepareKey([]rune(key))
+		if err != nil {
+			continue
+		}
+		if node := search(t.Root, runes); node != nil && node.IsEnd {
+			duplicates = append(duplicates, key)
+			continue
+		}
+		if node := search(batch.Root, runes); node != nil && node.IsEnd {
+			duplicates = append(duplicates, key)
+			continue
+		}
+		if t.checkDisjoint(runes, nil) != nil {
+			continue
+		}
+		if _, err := batch.insertKey(runes, struct{}{}); err != nil {
+			continue
+		}
+		added = append(added, key)
+	}
+	return added, duplicates
+}
+
+// PrefixesOf returns every key which is a prefix of query, including query itself, from shortest to longest.
+// It is the inverse of PrefixSearch, useful for segmenting text into dictionary words.
+func (t *Trie[T]) PrefixesOf(query string) []string {
+	prefixes := []string{}
+	node := t.Root
+	if node.IsEnd {
+		prefixes = append(prefixes, "")
+	}
+	runes := t.preparePrefix(query)
+	for i, r := range runes {
+		node = child(node, r)
+		if node == nil {
+			break
+		}
+		if node.IsEnd {
+			prefixes = append(prefixes, string(runes[:i+1]))
+		}
+	}
+	return prefixes
+}
+
+// Ancestors returns every key which is a proper prefix of key along with its value, from the root towards key.
+// Unlike PrefixesOf it leaves out key itself, so it suits inheriting settings from parent keys; key need not be stored.
+func (t *Trie[T]) Ancestors(key string) []Entry[T] {
+	ancestors := []Entry[T]{}
+	node := t.Root
+	runes := t.preparePrefix(key)
+	for i, r := range runes {
+		if node.IsEnd {
+			ancestors = append(ancestors, Entry[T]{Key: string(runes[:i]), Value: node.Value})
+		}
+		if node = child(node, r); node == nil {
+			break
+		}
+	}
+	return ancestors
+}
+
+// DeepestValueAlong walks path as far as it matches the trie, and returns the value of the deepest node reached
+// and its depth in runes, whether or not it is the end of a key. ok is false if not even the first rune matched.
+// Nodes which are not keys hold the zero value, unless it was set through NodeAt, for example to store inherited defaults.
+func (t *Trie[T]) DeepestValueAlong(path string) (value T, depth int, ok bool) {
+	node := t.Root
+	for _, r := range t.preparePrefix(path) {
+		next := child(node, r)
+		if next == nil {
+			break
+		}
+		node = next
+		depth++
+	}
+	if depth == 0 {
+		return *new(T), 0, false
+	}
+	return node.Value, depth, true
+}
+
+// SetPrefixValue attaches value to prefix, to be inherited by every key starting with it, see Resolve.
+// Prefix values are kept apart from keys: they don't count towards Len and aren't removed by Delete or Clear.
+func (t *Trie[T]) SetPrefixValue(prefix string, value T) {
+	if t.prefixValues == nil {
+		t.prefixValues = NewTrie[T]()
+	}
+	// insert returns the existing node if the prefix already has a value
+	node, created, err := insert(t.prefixValues.Root, t.preparePrefix(prefix), value, t.prefixValues.fanout)
+	t.prefixValues.nodes += created
+	if err == nil {
+		t.prefixValues.keys++
+	}
+	node.Value = value
+}
+
+// Resolve returns the value of key if it is in the trie, otherwise the value of the longest prefix of key
+// with a value set by SetPrefixValue, or the zero value if there is neither.
+func (t *Trie[T]) Resolve(key string) T {
+	if value, err := t.Search(key); err == nil {
+		return value
+	}
+	resolved := *new(T)
+	if t.prefixValues == nil {
+		return resolved
+	}
+	node := t.prefixValues.Root
+	if node.IsEnd {
+		resolved = node.Value
+	}
+	for _, r := range t.preparePrefix(key) {
+		node = child(node, r)
+		if node == nil {
+			break
+		}
+		if node.IsEnd {
+			resolved = node.Value
+		}
+	}
+	return resolved
+}
+
+// WalkPaths calls fn for every key in lexicographic order, along with the values of the nodes on its path:
+// pathValues[i] belongs to the prefix of the first i runes of key, so it starts with the root's and ends with key's own value.
+// A prefix's value is its value as a key, otherwise the value set on it by SetPrefixValue, otherwise the zero value.
+// pathValues is reused between calls, so fn must copy it to keep it.
+func (t *Trie[T]) WalkPaths(fn func(key string, pathValues []T)) {
+	var prefixRoot *Node[T]
+	if t.prefixValues != nil {
+		prefixRoot = t.prefixValues.Root
+	}
+	// prefixNodes[i] is the node in prefixValues for the prefix of the first i runes, or nil if it has none
+	prefixNodes := []*Node[T]{prefixRoot}
+	values := []T{pathValue(t.Root, prefixRoot)}
+	if t.Root.IsEnd {
+		fn("", values)
+	}
+	walkChildren(t.Root.Children, []rune{}, func(keys []rune, node *Node[T]) error {
+		depth := len(keys)
+		var prefixNode *Node[T]
+		if parent := prefixNodes[depth-1]; parent != nil {
+			prefixNode = child(parent, node.KeyRune)
+		}
+		prefixNodes = append(prefixNodes[:depth], prefixNode)
+		values = append(values[:depth], pathValue(node, prefixNode))
+		if node.IsEnd {
+			fn(nodeKey(node, keys), values)
+		}
+		return nil
+	})
+}
+
+// pathValue returns the value WalkPaths gives node, whose node in the prefix values is prefixNode
+func pathValue[T any](node, prefixNode *Node[T]) T {
+	if node.IsEnd {
+		return node.Value
+	}
+	if prefixNode != nil && prefixNode.IsEnd {
+		return prefixNode.Value
+	}
+	return *new(T)
+}
+
+// Classify reports, in a single descent, whether query is a key and whether it is a prefix of any longer key.
+func (t *Trie[T]) Classify(query string) (isKey bool, isPrefix bool) {
+	runes, err := t.prepareKey([]rune(query))
+	if err != nil {
+		return false, false
+	}
+	node := search(t.Root, runes)
+	if node == nil {
+		return false, false
+	}
+	return node.IsEnd, len(node.Children) > 0
+}
+
+// NodeAt returns the node at the end of the path prefix, and false if no key starts with prefix.
+// The node is part of the trie, so modifying it modifies the trie.
+func (t *Trie[T]) NodeAt(prefix string) (*Node[T], bool) {
+	node := search(t.Root, t.preparePrefix(prefix))
+	return node, node != nil
+}
+
+// NextRunes returns the runes which can follow prefix in a key, sorted, and false if no node lies on prefix's path.
+// They are the runes of the children of prefix's node, such as the keys to enable on an on-screen keyboard.
+func (t *Trie[T]) NextRunes(prefix string) ([]rune, bool) {
+	node := search(t.Root, t.preparePrefix(prefix))
+	if node == nil {
+		return nil, false
+	}
+	runes := make([]rune, len(node.Children))
+	for i, child := range node.Children {
+		runes[i] = child.KeyRune
+	}
+	return runes, true
+}
+
+// BranchFactor returns the number of runes which can follow prefix in a key, and false if no node lies on prefix's path.
+// When it is 1 and prefix is not itself a key, every key starting with prefix continues the same way,
+// so typeahead can fill in the next rune.
+func (t *Trie[T]) BranchFactor(prefix string) (int, bool) {
+	node := search(t.Root, t.preparePrefix(prefix))
+	if node == nil {
+		return 0, false
+	}
+	return len(node.Children), true
+}
+
+// search descends from node following key and returns the node at the end of the path, or nil if the path does not exist.
+// The returned node is not necessarily an end node.
+func search[T any](node *Node[T], key []rune) *Node[T] {
+	for _, r := range key {
+		node = child(node, r)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// SearchPath is like Search but also returns the nodes on the path to key, one per rune, ending with the key's node.
+// The path can be used to inspect or modify the nodes without descending again.
+func (t *Trie[T]) SearchPath(key string) (T, []*Node[T], error) {
+	runes, err := t.prepareKey([]rune(key))
+	if err != nil {
+		return *new(T), nil, keyError(key, err)
+	}
+	path := searchPath(t.Root, runes)
+	if path == nil || !path[len(path)-1].IsEnd {
+		return *new(T), nil, keyError(key, ErrNotFound)
+	}
+	return path[len(path)-1].Value, path[1:], nil
+}
+
+// searchASCII is like search for an ASCII key
+func searchASCII[T any](node *Node[T], key string) *Node[T] {
+	for i := 0; i < len(key); i++ {
+		node = child(node, rune(key[i]))
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// searchPath is like search but returns every node from node to the end of the path, or nil if the path does not exist
+func searchPath[T any](node *Node[T], key []rune) []*Node[T] {
+	path := make([]*Node[T], 0, len(key)+1)
+	path = append(path, node)
+	for _, r := range key {
+		node = child(node, r)
+		if node == nil {
+			return nil
+		}
+		path = append(path, node)
+	}
+	return path
+}
+
+// searchPathASCII is like searchPath for an ASCII key
+func searchPathASCII[T any](node *Node[T], key string) []*Node[T] {
+	path := make([]*Node[T], 0, len(key)+1)
+	path = append(path, node)
+	for i := 0; i < len(key); i++ {
+		node = child(node, rune(key[i]))
+		if node == nil {
+			return nil
+		}
+		path = append(path, node)
+	}
+	return path
+}
+
+func (t *Trie[T]) Delete(key string) (T, error) {
+	if !t.asciiKey(key) {
+		return t.DeleteRunes([]rune(key))
+	}
+	if err := t.checkASCIIKey(key); err != nil {
+		return t.deleteHook(key, *new(T), keyError(key, err))
+	}
+	val, removed, err := deletePath(searchPathASCII(t.Root, key))
+	t.countDelete(removed, err)
+	return t.deleteHook(key, val, keyError(key, err))
+}
+
+// DeleteRunes is like Delete but takes the key as runes.
+func (t *Trie[T]) DeleteRunes(key []rune) (T, error) {
+	prepared, err := t.prepareWrite(key)
+	if err != nil {
+		return t.deleteHook(string(key), *new(T), keyError(string(key), err))
+	}
+	val, removed, err := deleteNode(t.Root, prepared)
+	t.countDelete(removed, err)
+	return t.deleteHook(string(key), val, keyError(string(key), err))
+}
+
+// countDelete updates the counts of nodes and keys after deleting a key removed nodes, unless it failed with err
+func (t *Trie[T]) countDelete(removed int, err error) {
+	t.nodes -= removed
+	if err == nil {
+		t.keys--
+	}
+}
+
+// deleteHook runs the OnDelete hook for the result of deleting key, and returns value and err
+func (t *Trie[T]) deleteHook(key string, value T, err error) (T, error) {
+	if t.hooks.OnDelete != nil {
+		t.hooks.OnDelete(key, err == nil)
+	}
+	return value, err
+}
+
+// DeleteAndCheck is like Delete but also reports whether the trie is empty afterwards.
+// Emptiness comes from the maintained key count, so draining a trie doesn't need an extra traversal per key.
+func (t *Trie[T]) DeleteAndCheck(key string) (T, bool, error) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return *new(T), false, keyError(key, err)
+	}
+	val, removed, err := deleteNode(t.Root, runes)
+	t.countDelete(removed, err)
+	return val, t.keys == 0, keyError(key, err)
+}
+
+// DeleteAndCount is like Delete but also returns the number of nodes freed, including key's own node.
+// It is 0 if key's node still leads to other keys, and the length of key if no other key shares any prefix with it.
+func (t *Trie[T]) DeleteAndCount(key string) (T, int, error) {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return *new(T), 0, keyError(key, err)
+	}
+	val, removed, err := deleteNode(t.Root, runes)
+	t.countDelete(removed, err)
+	return val, removed, keyError(key, err)
+}
+
+// DeleteImpact returns the number of nodes Delete would remove for key, as DeleteAndCount counts them,
+// without changing the trie. It returns ErrNotFound if key is not in the trie.
+func (t *Trie[T]) DeleteImpact(key string) (int, error) {
+	runes, err := t.prepareKey([]rune(key))
+	if err != nil {
+		return 0, keyError(key, err)
+	}
+	path := searchPath(t.Root, runes)
+	if path == nil || !path[len(path)-1].IsEnd {
+		return 0, keyError(key, ErrNotFound)
+	}
+	return deleteImpact(path), nil
+}
+
+// deleteImpact counts the nodes prunePath would remove from path once its last node is no longer a key
+func deleteImpact[T any](path []*Node[T]) int {
+	removed := 0
+	for i := len(path) - 1; i > 0; i-- {
+		node := path[i]
+		// below the key's node, the only child left is the one being removed
+		children := len(node.Children)
+		if i < len(path)-1 {
+			children--
+		}
+		if children > 0 || (node.IsEnd && i < len(path)-1) {
+			break
+		}
+		removed++
+	}
+	return removed
+}
+
+// Rename moves the value at oldKey to newKey, keeping its sequence number, and removes oldKey.
+// It returns ErrNotFound if oldKey is not in the trie and ErrAlreadyExists if newKey is, leaving the trie unchanged.
+func (t *Trie[T]) Rename(oldKey, newKey string) error {
+	oldRunes, err := t.prepareWrite([]rune(oldKey))
+	if err != nil {
+		return keyError(oldKey, err)
+	}
+	newRunes, err := t.prepareWrite([]rune(newKey))
+	if err != nil {
+		return keyError(newKey, err)
+	}
+	oldNode := search(t.Root, oldRunes)
+	if oldNode == nil || !oldNode.IsEnd {
+		return keyError(oldKey, ErrNotFound)
+	}
+	if err := t.checkCapacity(newRunes); err != nil {
+		return keyError(newKey, err)
+	}
+	if err := t.checkDisjoint(newRunes, oldNode); err != nil {
+		return keyError(newKey, err)
+	}
+	newNode, created, err := insert(t.Root, newRunes, oldNode.Value, t.fanout)
+	t.nodes += created
+	if err != nil {
+		return keyError(newKey, err)
+	}
+	newNode.seq = oldNode.seq
+	if t.storeKeys {
+		newNode.key = string(newRunes)
+	}
+	_, removed, err := deleteNode(t.Root, oldRunes)
+	t.nodes -= removed
+	if err != nil {
+		// roll back the insert so the trie is left as it was
+		_, removed, _ = deleteNode(t.Root, newRunes)
+		t.nodes -= removed
+		return keyError(oldKey, err)
+	}
+	return nil
+}
+
+// SoftDelete removes key from the trie but keeps its node and value, so Undelete can cheaply restore it.
+// The node is left without a key below it if key has no longer keys, so Prune and Optimize remove it for good.
+func (t *Trie[T]) SoftDelete(key string) error {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return keyError(key, err)
+	}
+	node := search(t.Root, runes)
+	if node == nil || !node.IsEnd {
+		return keyError(key, ErrNotFound)
+	}
+	node.IsEnd = false
+	node.softDeleted = true
+	t.keys--
+	return nil
+}
+
+// Undelete restores a key removed by SoftDelete with its original value.
+// It returns ErrNotFound if key was not soft deleted, or its node has since been pruned or reused by Insert.
+// With WithStrictDisjoint it fails like Insert if a key inserted since then has key as a prefix.
+func (t *Trie[T]) Undelete(key string) error {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return keyError(key, err)
+	}
+	node := search(t.Root, runes)
+	if node == nil || !node.softDeleted {
+		return keyError(key, ErrNotFound)
+	}
+	if err := t.checkDisjoint(runes, nil); err != nil {
+		return keyError(key, err)
+	}
+	node.IsEnd = true
+	node.softDeleted = false
+	t.keys++
+	return nil
+}
+
+// PopPrefix deletes every key starting with prefix, including prefix itself, and returns them with their values
+// in lexicographic order. It returns ErrNotFound if no node lies on prefix's path.
+func (t *Trie[T]) PopPrefix(prefix string) ([]Entry[T], error) {
+	if t.minimized {
+		return nil, ErrMinimized
+	}
+	keys := t.preparePrefix(prefix)
+	path := searchPath(t.Root, keys)
+	if path == nil {
+		return nil, ErrNotFound
+	}
+	node := path[len(path)-1]
+	entries := []Entry[T]{}
+	walk(node, keys, func(key string, node *Node[T]) error {
+		if node.IsEnd {
+			entries = append(entries, Entry[T]{Key: key, Value: node.Value})
+		}
+		return nil
+	})
+	// drop the whole subtree, then the ancestors left without a key
+	t.nodes -= nodeCount(node) - 1
+	t.keys -= len(entries)
+	node.Children = []*Node[T]{}
+	node.childMap = nil
+	node.IsEnd = false
+	node.softDeleted = false
+	node.Value = *new(T)
+	t.nodes -= prunePath(path)
+	return entries, nil
+}
+
+// DeleteAll deletes every key in keys, carrying on past keys that fail.
+// The returned map holds the error for each key that could not be deleted, and is empty if all were deleted.
+func (t *Trie[T]) DeleteAll(keys []string) map[string]error {
+	errs := map[string]error{}
+	for _, key := range keys {
+		if _, err := t.Delete(key); err != nil {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+// deleteNode removes key below node along with every node left without a key below it.
+// It returns the deleted value and the number of nodes removed.
+func deleteNode[T any](node *Node[T], key []rune) (T, int, error) {
+	// keep every node on the path so they can be cleaned up bottom-up without recursion
+	return deletePath(searchPath(node, key))
+}
+
+// deletePath removes the key ending at the last node of path, as returned by searchPath, see deleteNode
+func deletePath[T any](path []*Node[T]) (T, int, error) {
+	if path == nil {
+		return *new(T), 0, ErrNotFound
+	}
+	node := path[len(path)-1]
+	// path exists but only as a prefix of other keys
+	if !node.IsEnd {
+		return *new(T), 0, ErrNotFound
+	}
+	val := node.Value
+	node.IsEnd = false // this removes the termination marker. Key will no longer be found
+	node.Value = *new(T)
+	node.key = ""
+
+	return val, prunePath(path), nil
+}
+
+// prunePath removes the nodes at the end of path which no longer lead to a key, stopping at the first one that still does.
+// It returns the number of nodes removed.
+func prunePath[T any](path []*Node[T]) int {
+	removed := 0
+	for i := len(path) - 1; i > 0 && prunable(path[i]); i-- {
+		parent := path[i-1]
+		j, _ := childIndex(parent, path[i].KeyRune)
+		removeChild(parent, j)
+		removed++
+	}
+	return removed
+}
+
+// prunable reports whether node neither is a key nor leads to one, so it can be removed from its parent
+func prunable[T any](node *Node[T]) bool {
+	return len(node.Children) < 1 && !node.IsEnd
+}
+
+// DeleteIf deletes every key for which pred returns true and returns the number of keys deleted.
+// Nodes left without a key below them are removed.
+func (t *Trie[T]) DeleteIf(pred func(key string, value T) bool) int {
+	if t.minimized {
+		return 0
+	}
+	removed, removedNodes, _ := deleteIf(t.Root, []rune{}, pred)
+	t.nodes -= removedNodes
+	t.keys -= removed
+	return removed
+}
+
+// deleteIf returns the number of keys and nodes removed below node, and whether node itself can be removed
+func deleteIf[T any](node *Node[T], keys []rune, pred func(string, T) bool) (int, int, bool) {
+	removed, removedNodes := 0, 0
+	if node.IsEnd && pred(string(keys), node.Value) {
+		node.IsEnd = false
+		node.Value = *new(T)
+		removed++
+	}
+	for i := range node.Children {
+		count, nodes, safeToDelete := deleteIf(node.Children[i], append(keys, node.Children[i].KeyRune), pred)
+		removed += count
+		removedNodes += nodes
+		if safeToDelete {
+			node.Children[i] = nil
+			removedNodes++
+		}
+	}
+	node.Children = slices.DeleteFunc(node.Children, func(n *Node[T]) bool { return n == nil })
+	indexChildren(node)
+	return removed, removedNodes, prunable(node)
+}
+
+// Sync changes the trie to hold exactly the keys and values of desired, making only the changes needed:
+// keys missing from desired are deleted, new keys are inserted in lexicographic order, and keys whose value differs
+// according to eq get the desired value. It returns the number of keys added, removed and updated.
+// Keys of desired rejected by the trie's options are left out, as are keys inserted once the trie is full,
+// so the trie only matches desired exactly if every key of it can be inserted.
+func (t *Trie[T]) Sync(desired map[string]T, eq func(a, b T) bool) (added, removed, updated int) {
+	value := func(_ string, v T) T { return v }
+	differs := func(old, v T) bool { return !eq(old, v) }
+	return reconcile(t, maps.All(desired), value, differs)
+}
+
+// RefreshKeys is like Sync for a source of keys without values: keys missing from keys are deleted,
+// and new keys are inserted in lexicographic order with the value returned by newValue, called with the key as stored.
+// Keys already in the trie keep their values. It returns the number of keys added and removed.
+// Keys rejected by the trie's options are left out, like in Sync.
+func (t *Trie[T]) RefreshKeys(keys []string, newValue func(key string) T) (added, removed int) {
+	want := func(yield func(string, struct{}) bool) {
+		for _, key := range keys {
+			if !yield(key, struct{}{}) {
+				return
+			}
+		}
+	}
+	value := func(key string, _ struct{}) T { return newValue(key) }
+	added, removed, _ = reconcile(t, want, value, nil)
+	return added, removed
+}
+
+// reconcile changes t to hold exactly the keys of want, as prepared by t, for Sync and RefreshKeys.
+// Keys missing from want are deleted, then the keys of want are inserted in lexicographic order with value(key, v),
+// called with the key as stored and its v. Keys already in t are given value(key, v) if update reports that their
+// old value should change, and are left alone if update is nil. A later key of want which prepares to the same key
+// as an earlier one replaces it.
+func reconcile[T, V any](t *Trie[T], want iter.Seq2[string, V], value func(key string, v V) T, update func(old T, v V) bool) (added, removed, updated int) {
+	if t.minimized {
+		return 0, 0, 0
+	}
+	// compare prepared keys, which are what the trie holds
+	prepared := map[string]V{}
+	for key, v := range want {
+		if runes, err := t.prepareKey([]rune(key)); err == nil {
+			prepared[string(runes)] = v
+		}
+	}
+	removed = t.DeleteIf(func(key string, _ T) bool {
+		_, ok := prepared[key]
+		return !ok
+	})
+	for _, key := range slices.Sorted(maps.Keys(prepared)) {
+		runes := []rune(key)
+		v := prepared[key]
+		if node := search(t.Root, runes); node != nil && node.IsEnd {
+			if update != nil && update(node.Value, v) {
+				node.Value = t.intern(value(key, v))
+				updated++
+			}
+			continue
+		}
+		if _, err := t.insertKey(runes, value(key, v)); err == nil {
+			added++
+		}
+	}
+	return added, removed, updated
+}
+
+// TrimToSize deletes the lowest scoring keys until at most max remain, and returns the number deleted.
+// Keys with equal scores are deleted in lexicographic order. Nodes left without a key below them are removed.
+// A negative max is treated as 0, deleting every key.
+func (t *Trie[T]) TrimToSize(max int, score func(key string, value T) int) int {
+	if max < 0 {
+		max = 0
+	}
+	type scored struct {
+		key   string
+		score int
+	}
+	fun := func(node *Node[T], key string, accumulator []scored) []scored {
+		return append(accumulator, scored{key, score(key, node.Value)})
+	}
+	keys := depthFirstSearchKeys(t.Root, fun, []scored{})
+	if len(keys) <= max {
+		return 0
+	}
+	slices.SortStableFunc(keys, func(a, b scored) int { return cmp.Compare(a.score, b.score) })
+	evict := make(map[string]bool, len(keys)-max)
+	for _, k := range keys[:len(keys)-max] {
+		evict[k.key] = true
+	}
+	return t.DeleteIf(func(key string, value T) bool { return evict[key] })
+}
+
+// Prune removes every node which neither is a key nor leads to one and returns the number of nodes removed.
+// Delete already cleans up after itself, so this is only needed to repair a trie whose nodes were modified directly.
+// It also recounts the nodes and keys reported by NodeCount and Len, which such changes leave out of date.
+func (t *Trie[T]) Prune() int {
+	if t.minimized {
+		// recounting would count shared nodes once per key below them
+		return 0
+	}
+	removed := prune(t.Root)
+	t.recount()
+	return removed
+}
+
+// recount sets the counts of nodes and keys from a full traversal, for when they can't be kept up to date
+func (t *Trie[T]) recount() {
+	t.nodes = nodeCount(t.Root) - 1
+	t.keys = keyCount(t.Root)
+}
+
+// prune works bottom-up, so a chain of orphaned nodes is removed in a single pass
+func prune[T any](node *Node[T]) int {
+	removed := 0
+	for i := range node.Children {
+		removed += prune(node.Children[i])
+		if prunable(node.Children[i]) {
+			node.Children[i] = nil
+			removed++
+		}
+	}
+	node.Children = slices.DeleteFunc(node.Children, func(n *Node[T]) bool { return n == nil })
+	indexChildren(node)
+	return removed
+}
+
+// Optimize reclaims memory after heavy churn, like a database VACUUM.
+// It prunes orphaned nodes, restores sorted children and copies every node's Children into a slice of exactly its length,
+// dropping the spare capacity left behind by inserts and deletes. Keys and values are unchanged.
+func (t *Trie[T]) Optimize() {
+	t.Prune()
+	compact(t.Root)
+}
+
+// OptimizeInto returns an optimized copy of the trie, as Optimize would leave it, and leaves t untouched.
+// This is the way to maintain a trie serving concurrent reads: keep it behind an atomic.Pointer,
+// build the copy while readers go on using the old trie, then Store the copy for new reads to pick up.
+// Only one goroutine may modify the trie at a time, and writes to the old trie after the copy is made are lost.
+func (t *Trie[T]) OptimizeInto() *Trie[T] {
+	optimized := t.Clone()
+	optimized.Optimize()
+	if optimized.prefixValues != nil {
+		optimized.prefixValues.Optimize()
+	}
+	return optimized
+}
+
+// compact tightens the Children slice of node and every node below it
+func compact[T any](node *Node[T]) {
+	children := make([]*Node[T], len(node.Children))
+	copy(children, node.Children)
+	slices.SortFunc(children, func(a, b *Node[T]) int { return cmp.Compare(a.KeyRune, b.KeyRune) })
+	node.Children = children
+	indexChildren(node)
+	for _, child := range node.Children {
+		compact(child)
+	}
+}
+
+// test if a deleting help when hello exists removes
+
+// GetAll returns every key in the trie in lexicographic order.
+func (t *Trie[T]) GetAll() []string {
+	// Create a function that will accumulate all words in trie
+	fun := func(node *Node[T], key string, accumulator []string) []string {
+		return append(accumulator, key)
+	}
+	// pre-order over sorted children visits keys in lexicographic order
+	return depthFirstSearchKeys(t.Root, fun, []string{})
+}
+
+// Len returns the number of keys stored in the trie. It is kept up to date by every change, so it does not traverse the trie.
+func (t *Trie[T]) Len() int {
+	return t.keys
+}
+
+// IsEmpty reports whether the trie holds no keys.
+// Nodes that don't lead to a key (e.g. left behind by modifying nodes directly) don't count, see Prune.
+// The search stops at the first key found, so for a trie built by Insert and Delete this is O(depth of the first key).
+func (t *Trie[T]) IsEmpty() bool {
+	return !hasKey(t.Root)
+}
+
+// hasKey reports whether node or any node below it is an end node
+func hasKey[T any](node *Node[T]) bool {
+	if node.IsEnd {
+		return true
+	}
+	return slices.ContainsFunc(node.Children, hasKey)
+}
+
+// MaximalKeys returns, in lexicographic order, every key which is not a prefix of another key,
+// so for "a", "ab" and "abc" only "abc" is returned.
+// Checking for keys below stops at the first one found, which for a trie built by Insert and Delete is its first child.
+func (t *Trie[T]) MaximalKeys() []string {
+	fun := func(node *Node[T], key string, keys []string) []string {
+		if slices.ContainsFunc(node.Children, hasKey) {
+			return keys
+		}
+		return append(keys, key)
+	}
+	return depthFirstSearchKeys(t.Root, fun, []string{})
+}
+
+// ToMap returns a snapshot of every key in the trie and its value.
+func (t *Trie[T]) ToMap() map[string]T {
+	fun := func(node *Node[T], key string, m map[string]T) map[string]T {
+		m[key] = node.Value
+		return m
+	}
+	return depthFirstSearchKeys(t.Root, fun, map[string]T{})
+}
+
+// NestedMapValueKey is the key under which ToNestedMap stores the value of a node ending a key.
+// Runes are stored under one-rune strings, so it can't clash with them.
+const NestedMapValueKey = "$value"
+
+// ToNestedMap returns the trie as nested maps mirroring its nodes, for tools that render JSON trees.
+// Each node is a map from the runes of its children, as strings, to their maps,
+// and a node ending a key also holds its value under NestedMapValueKey.
+func (t *Trie[T]) ToNestedMap() map[string]any {
+	return toNestedMap(t.Root)
+}
+
+func toNestedMap[T any](node *Node[T]) map[string]any {
+	m := make(map[string]any, len(node.Children)+1)
+	if node.IsEnd {
+		m[NestedMapValueKey] = node.Value
+	}
+	for _, child := range node.Children {
+		m[string(child.KeyRune)] = toNestedMap(child)
+	}
+	return m
+}
+
+// KeysByValue returns every key sorted by its value, using the comparison set with WithValueCompare.
+// Keys with equal values are in lexicographic order.
+// If the trie has no comparison, keys are returned in lexicographic order like GetAll.
+func (t *Trie[T]) KeysByValue() []string {
+	fun := func(node *Node[T], key string, entries []Entry[T]) []Entry[T] {
+		return append(entries, Entry[T]{Key: key, Value: node.Value})
+	}
+	entries := depthFirstSearchKeys(t.Root, fun, []Entry[T]{})
+	if t.compareValues != nil {
+		slices.SortStableFunc(entries, func(a, b Entry[T]) int { return t.compareValues(a.Value, b.Value) })
+	}
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+// Diff compares t with other and returns, in lexicographic order, the keys added in other,
+// the keys removed from t, and the keys in both whose values are not equal according to eq.
+func (t *Trie[T]) Diff(other *Trie[T], eq func(a, b T) bool) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+	t.Walk(func(key string, value T) error {
+		node := search(other.Root, []rune(key))
+		switch {
+		case node == nil || !node.IsEnd:
+			removed = append(removed, key)
+		case !eq(value, node.Value):
+			changed = append(changed, key)
+		}
+		return nil
+	})
+	other.Walk(func(key string, value T) error {
+		if node := search(t.Root, []rune(key)); node == nil || !node.IsEnd {
+			added = append(added, key)
+		}
+		return nil
+	})
+	return added, removed, changed
+}
+
+// ChangeCountSince returns the number of keys added, removed, or changed according to eq in t since baseline,
+// which is the total length of the slices Diff returns for baseline.Diff(t, eq). It walks both tries together
+// without building any key, and counts the keys of a subtree found in only one of them without comparing them.
+func (t *Trie[T]) ChangeCountSince(baseline *Trie[T], eq func(a, b T) bool) int {
+	return changeCount(baseline.Root, t.Root, eq)
+}
+
+// changeCount returns the number of keys which differ between the subtrees at a and b
+func changeCount[T any](a, b *Node[T], eq func(a, b T) bool) int {
+	count := 0
+	switch {
+	case a.IsEnd != b.IsEnd:
+		count++
+	case a.IsEnd && !eq(a.Value, b.Value):
+		count++
+	}
+	i, j := 0, 0
+	for i < len(a.Children) && j < len(b.Children) {
+		switch ar, br := a.Children[i].KeyRune, b.Children[j].KeyRune; {
+		case ar < br:
+			count += keyCount(a.Children[i])
+			i++
+		case ar > br:
+			count += keyCount(b.Children[j])
+			j++
+		default:
+			count += changeCount(a.Children[i], b.Children[j], eq)
+			i++
+			j++
+		}
+	}
+	for _, child := range a.Children[i:] {
+		count += keyCount(child)
+	}
+	for _, child := range b.Children[j:] {
+		count += keyCount(child)
+	}
+	return count
+}
+
+// keyCount returns the number of keys in the subtree at node, counting end nodes like nodeCount counts nodes,
+// without building their keys
+func keyCount[T any](node *Node[T]) int {
+	n := 0
+	if node.IsEnd {
+		n++
+	}
+	for _, child := range node.Children {
+		n += keyCount(child)
+	}
+	return n
+}
+
+// SubTrie returns a new trie holding the keys starting with prefix, and ErrNotFound if no node lies on prefix's path.
+// With keepPrefix false the prefix is stripped, so a prefix which is itself a key becomes the empty key.
+// Values are copied, so the new trie is independent of t unless T holds references. It keeps t's options.
+func (t *Trie[T]) SubTrie(prefix string, keepPrefix bool) (*Trie[T], error) {
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil {
+		return nil, ErrNotFound
+	}
+	sub := *t
+	// prefix values are relative to t's keys, so they don't carry over
+	sub.prefixValues = nil
+	sub.minimized = false
+	sub.interner = t.interner.clone()
+	sub.Root = cloneNode(node)
+	sub.Root.KeyRune = 0
+	sub.recount()
+	if !keepPrefix {
+		if sub.storeKeys {
+			// the keys lost the prefix, so the stored ones are stale, including those Undelete would bring back
+			walk(sub.Root, []rune{}, func(key string, node *Node[T]) error {
+				if node.IsEnd || node.softDeleted {
+					node.key = key
+				}
+				return nil
+			})
+		}
+		return &sub, nil
+	}
+	sub.nodes += len(keys)
+	// rebuild the prefix's path above the cloned subtree
+	for i := len(keys) - 1; i >= 0; i-- {
+		sub.Root.KeyRune = keys[i]
+		sub.Root = &Node[T]{Children: []*Node[T]{sub.Root}}
+	}
+	return &sub, nil
+}
+
+// Partition is a part of a trie split by Partitions: the keys starting with Prefix, held in Sub without it.
+type Partition[T any] struct {
+	Prefix string
+	Sub    *Trie[T]
+}
+
+// Partitions splits the trie into one Partition per rune its keys start with, in lexicographic order,
+// so they can be processed in parallel. The empty key, if stored, has its own partition with an empty prefix,
+// listed first. Each Sub is a copy made by SubTrie, so workers can't interfere with each other or with t,
+// at the cost of copying every node.
+func (t *Trie[T]) Partitions() []Partition[T] {
+	partitions := make([]Partition[T], 0, len(t.Root.Children)+1)
+	if t.Root.IsEnd {
+		sub := *t
+		sub.prefixValues = nil
+		sub.minimized = false
+		sub.interner = t.interner.clone()
+		sub.Root = &Node[T]{Value: t.Root.Value, IsEnd: true, seq: t.Root.seq, key: t.Root.key}
+		sub.nodes, sub.keys = 0, 1
+		partitions = append(partitions, Partition[T]{Prefix: "", Sub: &sub})
+	}
+	for _, child := range t.Root.Children {
+		prefix := string(child.KeyRune)
+		sub, _ := t.SubTrie(prefix, false)
+		partitions = append(partitions, Partition[T]{Prefix: prefix, Sub: sub})
+	}
+	return partitions
+}
+
+// Clone returns a copy of the trie with the same keys, values and options, which can be changed independently of t.
+// Values are copied by assignment, so if T holds pointers, slices or maps the copies share what they refer to;
+// use CloneWith to copy those too.
+func (t *Trie[T]) Clone() *Trie[T] {
+	return t.CloneWith(nil)
+}
+
+// CloneWith is like Clone but copies every value with cloneValue, such as slices.Clone for slice values,
+// so the values of the copy are independent of t's as well. A nil cloneValue copies values by assignment.
+func (t *Trie[T]) CloneWith(cloneValue func(T) T) *Trie[T] {
+	clone := *t
+	clone.interner = t.interner.clone()
+	clone.Root = cloneNodeWith(t.Root, cloneValue)
+	if t.prefixValues != nil {
+		clone.prefixValues = t.prefixValues.CloneWith(cloneValue)
+	}
+	if t.minimized {
+		// the copy no longer shares nodes, so is larger and can be modified
+		clone.minimized = false
+		clone.recount()
+	}
+	return &clone
+}
+
+// cloneNode returns a deep copy of node and every node below it, with values copied by assignment
+func cloneNode[T any](node *Node[T]) *Node[T] {
+	return cloneNodeWith(node, nil)
+}
+
+// cloneNodeWith is like cloneNode but copies the values of keys with cloneValue, if it is not nil.
+// Soft deleted keys are copied too, since Undelete can restore them.
+func cloneNodeWith[T any](node *Node[T], cloneValue func(T) T) *Node[T] {
+	value := node.Value
+	if cloneValue != nil && (node.IsEnd || node.softDeleted) {
+		value = cloneValue(value)
+	}
+	clone := &Node[T]{
+		Value:       value,
+		Children:    make([]*Node[T], len(node.Children)),
+		KeyRune:     node.KeyRune,
+		IsEnd:       node.IsEnd,
+		seq:         node.seq,
+		softDeleted: node.softDeleted,
+		key:         node.key,
+	}
+	for i, child := range node.Children {
+		clone.Children[i] = cloneNodeWith(child, cloneValue)
+	}
+	indexChildren(clone)
+	return clone
+}
+
+// KeysWithValue returns, in lexicographic order, every key whose value satisfies pred.
+// It is the read-only counterpart of DeleteIf.
+func (t *Trie[T]) KeysWithValue(pred func(T) bool) []string {
+	fun := func(node *Node[T], key string, accumulator []string) []string {
+		if pred(node.Value) {
+			return append(accumulator, key)
+		}
+		return accumulator
+	}
+	return depthFirstSearchKeys(t.Root, fun, []string{})
+}
+
+// KeysUpToDepth returns, in lexicographic order, every key of at most maxDepth runes.
+// The traversal does not descend below maxDepth, so its cost depends on the size of the shallow part of the trie only.
+func (t *Trie[T]) KeysUpToDepth(maxDepth int) []string {
+	if maxDepth < 0 {
+		return []string{}
+	}
+	return keysUpToDepth(t.Root, []rune{}, maxDepth, []string{})
+}
+
+func keysUpToDepth[T any](node *Node[T], keys []rune, maxDepth int, accumulator []string) []string {
+	if node.IsEnd {
+		accumulator = append(accumulator, string(keys))
+	}
+	if len(keys) == maxDepth {
+		return accumulator
+	}
+	for _, child := range node.Children {
+		accumulator = keysUpToDepth(child, append(keys, child.KeyRune), maxDepth, accumulator)
+	}
+	return accumulator
+}
+
+// MinKey returns the lexicographically smallest key in the trie, and false if the trie is empty.
+func (t *Trie[T]) MinKey() (string, bool) {
+	keys := []rune{}
+	node := t.Root
+	// a key is always smaller than any key it prefixes, so stop at the first end node
+	for !node.IsEnd {
+		if len(node.Children) == 0 {
+			return "", false
+		}
+		node = node.Children[0]
+		keys = append(keys, node.KeyRune)
+	}
+	return string(keys), true
+}
+
+// MaxKey returns the lexicographically largest key in the trie, and false if the trie is empty.
+func (t *Trie[T]) MaxKey() (string, bool) {
+	keys := []rune{}
+	node := t.Root
+	// any extension of a key is larger than the key, so descend as far as possible
+	for len(node.Children) > 0 {
+		node = node.Children[len(node.Children)-1]
+		keys = append(keys, node.KeyRune)
+	}
+	if !node.IsEnd {
+		return "", false
+	}
+	return string(keys), true
+}
+
+// ShortestKey returns the key with the fewest runes, and false if the trie is empty.
+// Ties are broken lexicographically.
+func (t *Trie[T]) ShortestKey() (string, bool) {
+	type item struct {
+		node *Node[T]
+		keys []rune
+	}
+	// breadth first so the first end node found is the closest to the root
+	queue := []item{{node: t.Root}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.node.IsEnd {
+			return string(current.keys), true
+		}
+		for _, child := range current.node.Children {
+			keys := append(slices.Clip(current.keys), child.KeyRune)
+			queue = append(queue, item{node: child, keys: keys})
+		}
+	}
+	return "", false
+}
+
+// CommonPrefix returns the longest prefix shared by every key in the trie, or "" if the trie is empty.
+func (t *Trie[T]) CommonPrefix() string {
+	keys := []rune{}
+	node := t.Root
+	// stop once keys diverge or one key ends, since that key is shorter than the others
+	for len(node.Children) == 1 && !node.IsEnd {
+		node = node.Children[0]
+		keys = append(keys, node.KeyRune)
+	}
+	return string(keys)
+}
+
+// MinimalPrefixCover returns, in lexicographic order, a set of prefixes such that every key starts with exactly one of them.
+// The rule is to take one prefix per first rune of the keys, the fewest possible short of the empty prefix,
+// and extend each to the common prefix of the keys under it, like CommonPrefix, so no prefix covers more than it must.
+// For "car", "cart" and "cat" along with "dog" and "door" the cover is "ca" and "do".
+// If the empty key is stored, only the empty prefix can cover it, so the cover is just "".
+func (t *Trie[T]) MinimalPrefixCover() []string {
+	if t.Root.IsEnd {
+		return []string{""}
+	}
+	cover := []string{}
+	for _, node := range t.Root.Children {
+		keys := []rune{node.KeyRune}
+		for len(node.Children) == 1 && !node.IsEnd {
+			node = node.Children[0]
+			keys = append(keys, node.KeyRune)
+		}
+		cover = append(cover, string(keys))
+	}
+	return cover
+}
+
+// Sample returns n keys chosen uniformly at random using rng, or every key if there are no more than n.
+// It reservoir samples the keys in a single walk, so it only keeps n keys in memory however many the trie holds.
+// The keys are not in lexicographic order, but the same seed for rng always gives the same sample of the same trie.
+func (t *Trie[T]) Sample(n int, rng *rand.Rand) []string {
+	sample := []string{}
+	if n <= 0 {
+		return sample
+	}
+	seen := 0
+	fun := func(node *Node[T], key string, sample []string) []string {
+		seen++
+		if len(sample) < n {
+			return append(sample, key)
+		}
+		if i := rng.IntN(seen); i < n {
+			sample[i] = key
+		}
+		return sample
+	}
+	return depthFirstSearchKeys(t.Root, fun, sample)
+}
+
+// KeysInRange returns every key k where lo <= k < hi, in lexicographic order.
+func (t *Trie[T]) KeysInRange(lo, hi string) []string {
+	lo, hi = string(t.preparePrefix(lo)), string(t.preparePrefix(hi))
+	if lo >= hi {
+		return []string{}
+	}
+	return keysInRange(t.Root, []rune{}, lo, hi, []string{})
+}
+
+func keysInRange[T any](node *Node[T], keys []rune, lo, hi string, accumulator []string) []string {
+	key := string(keys)
+	// every key below node starts with key, so it is no smaller than key
+	if key >= hi {
+		return accumulator
+	}
+	// if key is smaller than lo but not a prefix of it, so is every key below node
+	if key < lo && !strings.HasPrefix(lo, key) {
+		return accumulator
+	}
+	if node.IsEnd && key >= lo {
+		accumulator = append(accumulator, key)
+	}
+	for _, child := range node.Children {
+		accumulator = keysInRange(child, append(keys, child.KeyRune), lo, hi, accumulator)
+	}
+	return accumulator
+}
+
+// PrefixSearch returns every key starting with prefix, in lexicographic order.
+func (t *Trie[T]) PrefixSearch(prefix string) []string {
+	return t.SuggestN(prefix, math.MaxInt)
+}
+
+// PrefixSearchPage returns up to pageSize keys starting with prefix which are greater than after, in lexicographic order.
+// next is the last key returned, to pass as after for the following page, and is empty once there are no more keys.
+// Pass an empty after for the first page, which is also the only page that can hold the empty key.
+// The empty key can't be told apart from the end of the keys as a token, so page through it with a pageSize above 1.
+// Subtrees before after are skipped rather than traversed. It returns ErrNotFound if no node lies on prefix's path.
+func (t *Trie[T]) PrefixSearchPage(prefix string, pageSize int, after string) (keys []string, next string, err error) {
+	runes := t.preparePrefix(prefix)
+	node := search(t.Root, runes)
+	if node == nil {
+		return []string{}, "", ErrNotFound
+	}
+	if pageSize <= 0 {
+		return []string{}, "", nil
+	}
+	after = string(t.preparePrefix(after))
+	// ask for one more key than the page holds, to know whether there is a next page
+	keys = keysAfter(node, runes, after, after == "", pageSize+1, []string{})
+	if len(keys) <= pageSize {
+		return keys, "", nil
+	}
+	keys = keys[:pageSize]
+	return keys, keys[pageSize-1], nil
+}
+
+// keysAfter collects at most n keys below node greater than after, or equal to it if inclusive
+func keysAfter[T any](node *Node[T], keys []rune, after string, inclusive bool, n int, accumulator []string) []string {
+	key := string(keys)
+	// if key is smaller than after but not a prefix of it, so is every key below node
+	if key < after && !strings.HasPrefix(after, key) {
+		return accumulator
+	}
+	if node.IsEnd && (key > after || inclusive && key == after) {
+		accumulator = append(accumulator, key)
+	}
+	for _, child := range node.Children {
+		if len(accumulator) >= n {
+			break
+		}
+		accumulator = keysAfter(child, append(keys, child.KeyRune), after, inclusive, n, accumulator)
+	}
+	return accumulator
+}
+
+// IterFrom returns an iterator over every key greater than or equal to start and its value, in lexicographic order,
+// for resuming iteration over the whole trie from a cursor. Subtrees before start are skipped without being visited,
+// and iteration stops as soon as the loop over it does. The trie must not be modified during iteration.
+func (t *Trie[T]) IterFrom(start string) iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		iterFrom(t.Root, []rune{}, t.preparePrefix(start), yield)
+	}
+}
+
+// iterFrom yields the keys at and below node which are not before start, where node's key is keys, a prefix of start.
+// It returns false once yield has.
+func iterFrom[T any](node *Node[T], keys, start []rune, yield func(string, T) bool) bool {
+	if len(keys) == len(start) {
+		return iterAll(node, keys, yield)
+	}
+	// node's key is shorter than start, so it comes before it, as do the children before start's next rune
+	r := start[len(keys)]
+	i, found := childIndex(node, r)
+	if found {
+		if !iterFrom(node.Children[i], append(keys, r), start, yield) {
+			return false
+		}
+		i++
+	}
+	for _, child := range node.Children[i:] {
+		if !iterAll(child, append(keys, child.KeyRune), yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// iterAll yields every key at and below node, whose key is keys. It returns false once yield has.
+func iterAll[T any](node *Node[T], keys []rune, yield func(string, T) bool) bool {
+	if node.IsEnd && !yield(nodeKey(node, keys), node.Value) {
+		return false
+	}
+	return walkChildren(node.Children, keys, func(keys []rune, node *Node[T]) error {
+		if node.IsEnd && !yield(nodeKey(node, keys), node.Value) {
+			return errStopWalk
+		}
+		return nil
+	}) == nil
+}
+
+// SuggestN returns at most n keys starting with prefix, in lexicographic order.
+// The traversal stops as soon as n keys are found, so work is bounded by n rather than the size of the subtree.
+func (t *Trie[T]) SuggestN(prefix string, n int) []string {
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil || n <= 0 {
+		return []string{}
+	}
+	return suggest(node, keys, n, []string{})
+}
+
+func suggest[T any](node *Node[T], keys []rune, n int, accumulator []string) []string {
+	if node.IsEnd {
+		accumulator = append(accumulator, string(keys))
+	}
+	for _, child := range node.Children {
+		if len(accumulator) >= n {
+			break
+		}
+		accumulator = suggest(child, append(keys, child.KeyRune), n, accumulator)
+	}
+	return accumulator
+}
+
+// Entry is a key stored in a trie along with its value
+type Entry[T any] struct {
+	Key   string
+	Value T
+}
+
+// AutoComplete returns every key starting with prefix along with its value, in lexicographic order.
+func (t *Trie[T]) AutoComplete(prefix string) []Entry[T] {
+	entries := []Entry[T]{}
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil {
+		return entries
+	}
+	walk(node, keys, func(key string, node *Node[T]) error {
+		if node.IsEnd {
+			entries = append(entries, Entry[T]{Key: key, Value: node.Value})
+		}
+		return nil
+	})
+	return entries
 }
 
-type Node[T any] struct {
-	Value    T
-	Children []*Node[T]
-	KeyRune  rune
-	IsEnd    bool
+// Complete returns, in one descent, the value of prefix if it is a key, and up to limit longer keys starting with it
+// along with their values, in lexicographic order. exact is nil if prefix is not a key.
+func (t *Trie[T]) Complete(prefix string, limit int) (exact *T, suggestions []Entry[T]) {
+	suggestions = []Entry[T]{}
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil {
+		return nil, suggestions
+	}
+	if node.IsEnd {
+		value := node.Value
+		exact = &value
+	}
+	if limit <= 0 {
+		return exact, suggestions
+	}
+	for _, child := range node.Children {
+		err := walk(child, append(keys, child.KeyRune), func(key string, node *Node[T]) error {
+			if node.IsEnd {
+				suggestions = append(suggestions, Entry[T]{Key: key, Value: node.Value})
+			}
+			if len(suggestions) >= limit {
+				return errStopWalk
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+	return exact, suggestions
 }
 
-func (n Node[T]) String() string {
-	var s strings.Builder
-	for i := range n.Children {
-		s.WriteRune(n.Children[i].KeyRune)
-		s.WriteString(", ")
+// BestCompletion returns the best key starting with prefix, including prefix itself, and false if there is none.
+// The best key is the one no other key is less than, or the lexicographically smallest if less is nil.
+// With a nil less the walk stops at the first key found; otherwise every key below prefix is compared,
+// keeping only the best so far rather than collecting them.
+func (t *Trie[T]) BestCompletion(prefix string, less func(a, b string) bool) (string, bool) {
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil {
+		return "", false
 	}
-	return fmt.Sprintf("key='%s' val='%v' Children='%s'", string(n.KeyRune), n.Value, s.String())
+	best, found := "", false
+	walk(node, keys, func(key string, node *Node[T]) error {
+		if !node.IsEnd {
+			return nil
+		}
+		if !found || less(key, best) {
+			best, found = key, true
+		}
+		// keys are walked in lexicographic order, so the first is the smallest
+		if less == nil {
+			return errStopWalk
+		}
+		return nil
+	})
+	return best, found
 }
 
-func (t Trie[T]) String() string {
-	return fmt.Sprintf("\n%s\n", PrintTrie(t.Root, "", 0, true))
+// SuffixSearch returns every key ending with suffix, in lexicographic order.
+// This visits every key in the trie. Keeping a second trie of reversed keys would make it proportional to the matches,
+// but would double memory and the cost of every Insert and Delete, so a full traversal is preferred.
+func (t *Trie[T]) SuffixSearch(suffix string) []string {
+	keys := []string{}
+	suffix = string(t.preparePrefix(suffix))
+	t.Walk(func(key string, value T) error {
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys
 }
 
-func NewTrie[T any]() *Trie[T] {
-	return &Trie[T]{
-		Root: &Node[T]{},
+// Fingerprint returns a hash of the keys and values of the trie, with values hashed by valueHash.
+// Keys are hashed in lexicographic order, so tries holding the same keys and values have the same fingerprint
+// however they were built. It is FNV-1a over each key's length, key and value hash, so it is not cryptographic.
+func (t *Trie[T]) Fingerprint(valueHash func(T) uint64) uint64 {
+	h := fnv.New64a()
+	buf := []byte{}
+	t.Walk(func(key string, value T) error {
+		// the length keeps keys apart, so "ab" then "c" doesn't hash like "a" then "bc"
+		buf = binary.LittleEndian.AppendUint64(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.LittleEndian.AppendUint64(buf, valueHash(value))
+		h.Write(buf)
+		return nil
+	})
+	return h.Sum64()
+}
+
+// FrontCodedKey is a key stored as the number of leading runes it shares with the key before it, and the rest of it.
+type FrontCodedKey struct {
+	Shared int
+	Suffix string
+}
+
+// FrontCode returns the keys in lexicographic order, front coded: each key is given as the number of runes
+// it shares with the previous key, followed by the runes after those. Sorted keys share long prefixes,
+// so this shrinks dumps of dictionaries. The first key shares nothing.
+// A key can be rebuilt by appending Suffix to the first Shared runes of the previous key.
+func (t *Trie[T]) FrontCode() []FrontCodedKey {
+	codes := []FrontCodedKey{}
+	// the depth of the shallowest node entered since the previous key, which is where the two keys part
+	shared := 0
+	var visit func(node *Node[T], keys []rune)
+	visit = func(node *Node[T], keys []rune) {
+		if node.IsEnd {
+			codes = append(codes, FrontCodedKey{Shared: shared, Suffix: string(keys[shared:])})
+			shared = len(keys)
+		}
+		for _, child := range node.Children {
+			visit(child, append(keys, child.KeyRune))
+			shared = min(shared, len(keys))
+		}
 	}
+	visit(t.Root, []rune{})
+	return codes
 }
 
-// Operations
+// Dump returns one "key\tvalue" line per key, in lexicographic order, with values formatted by %v.
+// The output is stable, so dumps of two tries can be compared with diff.
+func (t *Trie[T]) Dump() string {
+	var s strings.Builder
+	t.Walk(func(key string, value T) error {
+		fmt.Fprintf(&s, "%s\t%v\n", key, value)
+		return nil
+	})
+	return s.String()
+}
 
-func (t *Trie[T]) Insert(key string, value T) error {
-	return insert(t.Root, []rune(key), value)
+// Walk calls fn for every key in lexicographic order. If fn returns an error the walk stops and returns it.
+func (t *Trie[T]) Walk(fn func(key string, value T) error) error {
+	return t.WalkContext(context.Background(), fn)
 }
 
-func insert[T any](node *Node[T], key []rune, value T) error {
-	if len(key) == 0 {
+// WalkContext is like Walk but checks ctx before visiting each node and stops with ctx.Err() once it is done.
+func (t *Trie[T]) WalkContext(ctx context.Context, fn func(key string, value T) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t.Root.IsEnd {
+		if err := fn("", t.Root.Value); err != nil {
+			return err
+		}
+	}
+	// only keys are turned into strings, which matters for long chains of nodes
+	return walkChildren(t.Root.Children, []rune{}, func(keys []rune, node *Node[T]) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if node.IsEnd {
-			return ErrAlreadyExists
+			return fn(nodeKey(node, keys), node.Value)
 		}
-		node.IsEnd = true
-		node.Value = value
 		return nil
+	})
+}
+
+// nodeKey returns the key ending at node, whose path from the root is keys,
+// taking it from node if the trie stores keys rather than building it from keys
+func nodeKey[T any](node *Node[T], keys []rune) string {
+	if node.key != "" {
+		return node.key
 	}
+	return string(keys)
+}
 
-	if node == nil {
-		return ErrAlreadyExists
+// Order is the order WalkOrdered visits keys in
+type Order int
+
+const (
+	// PreOrder visits a key before the keys below it, which is lexicographic order
+	PreOrder Order = iota
+	// PostOrder visits a key after the keys below it
+	PostOrder
+	// LevelOrder visits keys by length, shortest first, and lexicographically among keys of the same length
+	LevelOrder
+)
+
+// WalkOrdered is like Walk but visits keys in the given order.
+func (t *Trie[T]) WalkOrdered(order Order, fn func(key string, value T) error) error {
+	visit := func(key string, node *Node[T]) error {
+		if node.IsEnd {
+			return fn(key, node.Value)
+		}
+		return nil
 	}
-	for i := range node.Children {
-		if key[0] == node.Children[i].KeyRune {
-			err := insert(node.Children[i], key[1:], value)
+	switch order {
+	case PreOrder:
+		return walk(t.Root, []rune{}, visit)
+	case PostOrder:
+		return walkPostOrder(t.Root, []rune{}, visit)
+	case LevelOrder:
+		return walkLevelOrder(t.Root, visit)
+	}
+	return fmt.Errorf("unknown walk order %d", order)
+}
+
+// walkPostOrder is like walk but calls nodeFun on a node after the nodes below it
+func walkPostOrder[T any](node *Node[T], keys []rune, nodeFun func(string, *Node[T]) error) error {
+	for _, child := range node.Children {
+		if err := walkPostOrder(child, append(keys, child.KeyRune), nodeFun); err != nil {
 			return err
 		}
 	}
+	return nodeFun(string(keys), node)
+}
+
+// walkLevelOrder is like walk but calls nodeFun on every node of a level before moving on to the next
+func walkLevelOrder[T any](node *Node[T], nodeFun func(string, *Node[T]) error) error {
+	_, err := breadthFirstSearch([]*Node[T]{node}, []rune{}, func(node *Node[T], _ int, key string, _ struct{}) (struct{}, error) {
+		return struct{}{}, nodeFun(key, node)
+	}, struct{}{})
+	return err
+}
 
-	newNode := &Node[T]{
-		Children: []*Node[T]{},
-		KeyRune:  key[0],
-		Value:    *new(T),
-		IsEnd:    false,
+// WalkPrefix is like Walk but only calls fn for keys starting with prefix, including prefix itself.
+// It returns ErrNotFound if no node lies on prefix's path.
+func (t *Trie[T]) WalkPrefix(prefix string, fn func(key string, value T) error) error {
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil {
+		return ErrNotFound
 	}
-	// slog.Debug("insert new node", "node", newNode, "isEnd", isTerminal)
-	// slog.Debug("node.children", "children", node.Children)
+	return walk(node, keys, func(key string, node *Node[T]) error {
+		if node.IsEnd {
+			return fn(key, node.Value)
+		}
+		return nil
+	})
+}
 
-	node.Children = append(node.Children, newNode)
-	// have we created a terminal node? (last char)
-	if len(key) == 1 {
-		newNode.Value = value
-		newNode.IsEnd = true
+// MapValues replaces the value of every key with fn's result, in a single pass in lexicographic order.
+// Keys are left untouched.
+func (t *Trie[T]) MapValues(fn func(key string, old T) T) {
+	if t.minimized {
+		return
+	}
+	walk(t.Root, []rune{}, func(key string, node *Node[T]) error {
+		if node.IsEnd {
+			node.Value = fn(key, node.Value)
+		}
 		return nil
+	})
+}
+
+// WalkNodes calls fn for every node below the root in lexicographic pre-order, with the path of runes leading to it.
+// Nodes are visited whether or not they are the end of a key.
+// fn must treat the node as read-only: modifying its Children changes which nodes are visited,
+// and leaving a node without a key below it breaks the trie's invariants, see Prune.
+func (t *Trie[T]) WalkNodes(fn func(path string, node *Node[T])) {
+	for _, child := range t.Root.Children {
+		walk(child, []rune{child.KeyRune}, func(path string, node *Node[T]) error {
+			fn(path, node)
+			return nil
+		})
 	}
-	return insert(newNode, key[1:], value)
 }
 
-func (t *Trie[T]) Search(key string) (T, error) {
-	// TODO: do recursively and return index path
-	current := t.Root
-	for i, char := range key {
-		for _, node := range current.Children {
-			if node.KeyRune == char {
-				if node.IsEnd && (i+1) == len(key) {
-					return node.Value, nil
-				}
-				current = node
-				break
+// WalkBranchPoints is like WalkNodes but only calls fn for nodes which end a key or have more than one child,
+// skipping the chains of single-child nodes between them, as a radix tree would merge them.
+// The root is included if it is one, with an empty prefix.
+func (t *Trie[T]) WalkBranchPoints(fn func(prefix string, node *Node[T])) {
+	branchPoint := func(node *Node[T]) bool {
+		return node.IsEnd || len(node.Children) > 1
+	}
+	if branchPoint(t.Root) {
+		fn("", t.Root)
+	}
+	walkChildren(t.Root.Children, []rune{}, func(keys []rune, node *Node[T]) error {
+		if branchPoint(node) {
+			fn(string(keys), node)
+		}
+		return nil
+	})
+}
+
+// Stream sends every key in lexicographic order on the returned channel, which is closed once all keys are sent.
+// Cancel ctx to stop early, otherwise the goroutine producing keys blocks until they are all read.
+// The trie must not be modified until the channel is closed.
+func (t *Trie[T]) Stream(ctx context.Context) <-chan string {
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		t.WalkContext(ctx, func(key string, value T) error {
+			select {
+			case keys <- key:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
 			}
+		})
+	}()
+	return keys
+}
+
+// walk calls nodeFun on node and every node below it in lexicographic pre-order, stopping at the first error.
+// It keeps its own stack of nodes to visit rather than recursing, so deep tries don't grow the goroutine stack.
+func walk[T any](node *Node[T], keys []rune, nodeFun func(string, *Node[T]) error) error {
+	if err := nodeFun(string(keys), node); err != nil {
+		return err
+	}
+	return walkChildren(node.Children, keys, func(keys []rune, node *Node[T]) error {
+		return nodeFun(string(keys), node)
+	})
+}
+
+// walkChildren calls nodeFun on every node in nodes and below them in lexicographic pre-order, stopping at the first error.
+// nodes are the children of the node at keys, and each node is given its own key, which is only valid during the call.
+func walkChildren[T any](nodes []*Node[T], keys []rune, nodeFun func([]rune, *Node[T]) error) error {
+	base := len(keys)
+	// stack[i] holds the siblings left to visit i+1 runes below keys
+	stack := [][]*Node[T]{nodes}
+	for len(stack) > 0 {
+		top := len(stack) - 1
+		if len(stack[top]) == 0 {
+			stack = stack[:top]
+			continue
+		}
+		node := stack[top][0]
+		stack[top] = stack[top][1:]
+		keys = append(keys[:base+top], node.KeyRune)
+		if err := nodeFun(keys, node); err != nil {
+			return err
+		}
+		if len(node.Children) > 0 {
+			stack = append(stack, node.Children)
 		}
 	}
-	return *new(T), ErrNotFound
+	return nil
 }
 
-func (t *Trie[T]) Delete(key string) (T, error) {
-	val, _, err := deleteNode(t.Root, []rune(key))
-	return val, err
+// TrieStats describes the shape of a trie, see Trie.Stats
+type TrieStats struct {
+	Nodes int // nodes below the root
+	Keys  int
+	// MaxDepth is the length in runes of the longest key
+	MaxDepth int
+	// AvgBranching is the average number of children of nodes that have any, including the root
+	AvgBranching float64
+	// EstimatedBytes is a rough estimate of memory used by nodes and their children slices, excluding anything referenced by values
+	EstimatedBytes uintptr
 }
 
-func deleteNode[T any](node *Node[T], key []rune) (T, bool, error) {
-	// found key
-	if len(key) == 0 {
-		node.IsEnd = false // this removes the termination marker. Key will no longer be found
-		// If node is Terminal, we can safely delete it, return true
-		if len(node.Children) == 0 {
-			return node.Value, true, nil
-		} else {
-			// Has other children, so  this is just a substring of another key. don't delete
-			return node.Value, false, nil
+// Stats computes TrieStats in a single traversal
+func (t *Trie[T]) Stats() TrieStats {
+	stats := TrieStats{}
+	internalNodes := 0
+	var walk func(node *Node[T], depth int)
+	walk = func(node *Node[T], depth int) {
+		stats.EstimatedBytes += unsafe.Sizeof(*node) + uintptr(cap(node.Children))*unsafe.Sizeof(node)
+		if node.IsEnd {
+			stats.Keys++
+		}
+		stats.MaxDepth = max(stats.MaxDepth, depth)
+		if len(node.Children) > 0 {
+			internalNodes++
+		}
+		stats.Nodes += len(node.Children)
+		for _, child := range node.Children {
+			walk(child, depth+1)
 		}
 	}
-	// not found key
-	keyRune := key[0] // take first char
-	for i := range node.Children {
-		if node.Children[i].KeyRune == keyRune {
-			// DFS into subsequent children that match the key chars
-			val, safeToDelete, err := deleteNode(node.Children[i], key[1:])
-			if err != nil { // did not find key
-				return *new(T), false, err
-			}
-			// key has been found. Can we safely delete it?
-			// Node is safe to delete if it the key has no children. which was already determined
-			if safeToDelete {
-				node.Children[i] = nil
-				node.Children = slices.Delete(node.Children, i, i+1)
+	walk(t.Root, 0)
+	if internalNodes > 0 {
+		stats.AvgBranching = float64(stats.Nodes) / float64(internalNodes)
+	}
+	return stats
+}
+
+// CompressionPotential counts, in one traversal, the nodes below the root and how many of them are single-child chain nodes:
+// nodes which are not the end of a key and have exactly one child, so a radix trie would merge them into their child.
+// A high fraction of chain nodes means compacting to a radix trie would save a lot of nodes.
+func (t *Trie[T]) CompressionPotential() (singleChildChains int, totalNodes int) {
+	for _, child := range t.Root.Children {
+		walk(child, nil, func(_ string, node *Node[T]) error {
+			totalNodes++
+			if !node.IsEnd && len(node.Children) == 1 {
+				singleChildChains++
 			}
-			// also delete current node if it doesn't have any siblings. This will cleanup all unterminated leafs
-			if len(node.Children) < 1 && !node.IsEnd {
-				return val, true, nil
+			return nil
+		})
+	}
+	return singleChildChains, totalNodes
+}
+
+// BusiestPrefix returns the non-empty prefix with the most keys starting with it, including itself,
+// and that number of keys. Ties go to the lexicographically smallest prefix, and an empty trie returns "" and 0.
+// A prefix has at least as many keys as any longer prefix extending it, and wins ties with it,
+// so the busiest prefix is always one rune long.
+func (t *Trie[T]) BusiestPrefix() (prefix string, completions int) {
+	var count func(node *Node[T], keys []rune) int
+	count = func(node *Node[T], keys []rune) int {
+		n := 0
+		if node.IsEnd {
+			n++
+		}
+		for _, child := range node.Children {
+			n += count(child, append(keys, child.KeyRune))
+		}
+		if len(keys) > 0 && (n > completions || n == completions && string(keys) < prefix) {
+			prefix, completions = string(keys), n
+		}
+		return n
+	}
+	count(t.Root, []rune{})
+	return prefix, completions
+}
+
+// LongestSharedPrefix returns the longest prefix of two or more keys, including itself if it is a key,
+// and the number of keys starting with it, so for "caalcu" and "caalcr" it returns "caalc" and 2.
+// Ties between prefixes of the same length go to the one with more keys, then the lexicographically smallest.
+// A trie with fewer than two keys returns "" and 0.
+func (t *Trie[T]) LongestSharedPrefix() (prefix string, count int) {
+	depth := -1
+	var shared func(node *Node[T], keys []rune) int
+	shared = func(node *Node[T], keys []rune) int {
+		n := 0
+		if node.IsEnd {
+			n++
+		}
+		for _, child := range node.Children {
+			n += shared(child, append(keys, child.KeyRune))
+		}
+		if n >= 2 && (len(keys) > depth || len(keys) == depth && (n > count || n == count && string(keys) < prefix)) {
+			prefix, count, depth = string(keys), n, len(keys)
+		}
+		return n
+	}
+	shared(t.Root, []rune{})
+	return prefix, count
+}
+
+// EquivalentSuffixGroups returns the number of groups of two or more identical subtrees below the root.
+// Subtrees are identical when they hold the same keys relative to their top node, ignoring values and
+// the rune leading into them, so "cars" and "bars" give a group for the subtrees below "c" and "b",
+// and one for each level below. Minimizing the trie into a DAWG keeps one subtree per group,
+// so many groups mean a lot of repeated suffixes.
+func (t *Trie[T]) EquivalentSuffixGroups() int {
+	s := suffixIndex[T]{ids: map[string]int{}}
+	for _, child := range t.Root.Children {
+		s.id(child)
+	}
+	groups := 0
+	for _, count := range s.counts {
+		if count > 1 {
+			groups++
+		}
+	}
+	return groups
+}
+
+// Minimize merges identical subtrees so they are shared by pointer, turning the trie into a minimal acyclic
+// automaton (DAWG) for its current keys, and returns the number of nodes removed. Subtrees only merge if the
+// values of their keys are equal according to eq, so a trie whose values differ per key shrinks little.
+// With WithStoredKeys every key's node holds its own key, so only subtrees without keys can merge.
+// The result is read-only, since an insert or delete below a shared node would change every key sharing it:
+// methods changing keys or values return ErrMinimized or do nothing, and Sequence reports no numbers.
+// Clone, SubTrie and Partitions copy shared nodes apart again, for a trie that can be modified.
+// NodeCount counts shared nodes once, so it drops by the number of nodes removed.
+func (t *Trie[T]) Minimize(eq func(a, b T) bool) int {
+	m := minimizer[T]{eq: eq, canonical: map[string][]*Node[T]{}}
+	before := t.nodes
+	t.Root.Children = m.minimizeChildren(t.Root)
+	indexChildren(t.Root)
+	after := 0
+	for _, nodes := range m.canonical {
+		after += len(nodes)
+	}
+	t.nodes = after
+	t.minimized = true
+	return before - after
+}
+
+// minimizer finds the shared copy of each subtree, see Minimize
+type minimizer[T any] struct {
+	eq func(a, b T) bool
+	// canonical maps the signature of a subtree to the distinct subtrees with it, which only differ in their values
+	canonical map[string][]*Node[T]
+}
+
+// minimizeChildren returns the children of node replaced by their shared copies
+func (m *minimizer[T]) minimizeChildren(node *Node[T]) []*Node[T] {
+	children := make([]*Node[T], len(node.Children))
+	for i, child := range node.Children {
+		children[i] = m.minimize(child)
+	}
+	return children
+}
+
+// minimize returns the shared copy of the subtree at node, which is node itself if it is the first of its kind
+func (m *minimizer[T]) minimize(node *Node[T]) *Node[T] {
+	node.Children = m.minimizeChildren(node)
+	indexChildren(node)
+	// children are already shared, so two subtrees are identical when their children are the same nodes
+	var signature strings.Builder
+	fmt.Fprintf(&signature, "%d %t %t %q", node.KeyRune, node.IsEnd, node.softDeleted, node.key)
+	for _, child := range node.Children {
+		fmt.Fprintf(&signature, " %p", child)
+	}
+	key := signature.String()
+	for _, other := range m.canonical[key] {
+		if !(node.IsEnd || node.softDeleted) || m.eq(node.Value, other.Value) {
+			return other
+		}
+	}
+	m.canonical[key] = append(m.canonical[key], node)
+	return node
+}
+
+// suffixIndex numbers the distinct shapes of subtrees, which identifies subtrees holding the same keys
+type suffixIndex[T any] struct {
+	// ids maps the signature of a subtree to its id
+	ids map[string]int
+	// counts holds the number of subtrees seen with each id
+	counts []int
+}
+
+// id returns the id of the subtree at node, numbering it if it is the first of its shape
+func (s *suffixIndex[T]) id(node *Node[T]) int {
+	// a subtree is defined by whether it ends a key and the rune and id of each child
+	var signature strings.Builder
+	if node.IsEnd {
+		signature.WriteByte('$')
+	}
+	for _, child := range node.Children {
+		fmt.Fprintf(&signature, "%d:%d,", child.KeyRune, s.id(child))
+	}
+	id, ok := s.ids[signature.String()]
+	if !ok {
+		id = len(s.counts)
+		s.ids[signature.String()] = id
+		s.counts = append(s.counts, 0)
+	}
+	s.counts[id]++
+	return id
+}
+
+// MergeableChains returns, in lexicographic order, the prefix at the top of every chain of single-child nodes
+// which are not the end of a key, the nodes CompressionPotential counts. Deletes can leave such chains behind
+// where keys used to branch. It only finds the chains. There is no CompactChains to collapse them in place,
+// since every traversal relies on a node holding exactly one rune in KeyRune.
+func (t *Trie[T]) MergeableChains() []string {
+	chains := []string{}
+	var visit func(node *Node[T], keys []rune, parentInChain bool)
+	visit = func(node *Node[T], keys []rune, parentInChain bool) {
+		inChain := !node.IsEnd && len(node.Children) == 1
+		if inChain && !parentInChain {
+			chains = append(chains, string(keys))
+		}
+		for _, child := range node.Children {
+			visit(child, append(keys, child.KeyRune), inChain)
+		}
+	}
+	// the root is never merged, so chains start below it
+	for _, child := range t.Root.Children {
+		visit(child, []rune{child.KeyRune}, false)
+	}
+	return chains
+}
+
+// DepthHistogram returns the number of nodes at each depth, where index i counts the nodes i runes below the root.
+// The root is the only node at depth 0.
+func (t *Trie[T]) DepthHistogram() []int {
+	histogram := func(_ *Node[T], level int, _ string, counts []int) ([]int, error) {
+		for len(counts) <= level {
+			counts = append(counts, 0)
+		}
+		counts[level]++
+		return counts, nil
+	}
+	counts, _ := breadthFirstSearch([]*Node[T]{t.Root}, []rune{}, histogram, []int{})
+	return counts
+}
+
+// Validate checks the invariants of every node, for debugging corruption such as from editing nodes directly.
+// Children must be non-nil, sorted by KeyRune without duplicates and indexed consistently, only the root may have KeyRune 0,
+// and every leaf must be a key, unless it was soft deleted. The returned error wraps ErrCorruptTrie and names the path to the first bad node.
+func (t *Trie[T]) Validate() error {
+	return validate(t.Root, []rune{})
+}
+
+func validate[T any](node *Node[T], keys []rune) error {
+	path := string(keys)
+	if len(keys) > 0 && node.KeyRune == 0 {
+		return fmt.Errorf("%w: node %q has no rune", ErrCorruptTrie, path)
+	}
+	if len(node.Children) == 0 && !node.IsEnd && !node.softDeleted && len(keys) > 0 {
+		return fmt.Errorf("%w: leaf %q is not a key", ErrCorruptTrie, path)
+	}
+	if node.childMap != nil && len(node.childMap) != len(node.Children) {
+		return fmt.Errorf("%w: children of %q are indexed inconsistently", ErrCorruptTrie, path)
+	}
+	for i, child := range node.Children {
+		if child == nil {
+			return fmt.Errorf("%w: node %q has a nil child at %d", ErrCorruptTrie, path, i)
+		}
+		if i > 0 && node.Children[i-1] != nil {
+			switch cmp.Compare(node.Children[i-1].KeyRune, child.KeyRune) {
+			case 0:
+				return fmt.Errorf("%w: node %q has two children for %q", ErrCorruptTrie, path, child.KeyRune)
+			case 1:
+				return fmt.Errorf("%w: children of %q are not sorted", ErrCorruptTrie, path)
 			}
-			return val, false, nil
+		}
+		if node.childMap != nil && node.childMap[child.KeyRune] != child {
+			return fmt.Errorf("%w: children of %q are indexed inconsistently", ErrCorruptTrie, path)
+		}
+		if err := validate(child, append(keys, child.KeyRune)); err != nil {
+			return err
 		}
 	}
-	return *new(T), false, ErrNotFound
+	return nil
 }
 
-// test if a deleting help when hello exists removes
+// Repair merges sibling nodes holding the same rune, which make Search miss keys below all but one of them,
+// and returns the number of merges. Children are sorted first, so duplicates need not be next to each other.
+// Merged subtrees are repaired recursively. If both duplicates end a key, the value of the one first in
+// Children is kept. Nil children are dropped without counting as merges. Use Validate to check whether a trie
+// needs repairing.
+func (t *Trie[T]) Repair() int {
+	if t.minimized {
+		return 0
+	}
+	merges := repair(t.Root)
+	t.recount()
+	return merges
+}
 
-func (t *Trie[T]) GetAll() []string {
-	// Create a function that will accumulate all words in trie
-	fun := func(nodes **Node[T], key string, accumulator []string) []string {
-		if (*nodes).IsEnd {
-			return append(accumulator, key)
+func repair[T any](node *Node[T]) int {
+	merges := 0
+	node.Children = slices.DeleteFunc(node.Children, func(child *Node[T]) bool { return child == nil })
+	slices.SortStableFunc(node.Children, func(a, b *Node[T]) int {
+		return cmp.Compare(a.KeyRune, b.KeyRune)
+	})
+	children := node.Children[:0]
+	for _, child := range node.Children {
+		last := len(children) - 1
+		if last < 0 || children[last].KeyRune != child.KeyRune {
+			children = append(children, child)
+			continue
 		}
-		return accumulator
+		kept := children[last]
+		if !kept.IsEnd && child.IsEnd {
+			kept.IsEnd = true
+			kept.softDeleted = false
+			kept.Value = child.Value
+			kept.seq = child.seq
+			kept.key = child.key
+		}
+		kept.Children = append(kept.Children, child.Children...)
+		merges++
 	}
-	return depthFirstSearchEveryNode(t.Root.Children, []rune{}, fun, []string{})
+	clear(node.Children[len(children):])
+	node.Children = children
+	for _, child := range node.Children {
+		merges += repair(child)
+	}
+	indexChildren(node)
+	return merges
 }
 
-func (t *Trie[T]) Clear() {
-	// DFS over every node and delete it (mark node nil for GC)
-	fun := func(nodes **Node[T], key string, accumulator []string) []string {
-		nodes = nil
-		return nil
+// NodeCount returns the number of nodes below the root, so an empty trie has none. Compare with Len, which counts keys.
+// Like Len it is kept up to date rather than counted, so after modifying nodes directly, call Prune to recount.
+func (t *Trie[T]) NodeCount() int {
+	return t.nodes
+}
+
+// nodeCount returns the number of nodes in the subtree rooted at node, including node
+func nodeCount[T any](node *Node[T]) int {
+	n := 1
+	for _, child := range node.Children {
+		n += nodeCount(child)
 	}
-	depthFirstSearchEveryNode(t.Root.Children, []rune{}, fun, nil)
-	// reset the root node to
+	return n
+}
+
+// Clear removes every key from the trie.
+// The old nodes are no longer reachable from the trie and are left for the GC, so this does not traverse the tree.
+func (t *Trie[T]) Clear() {
 	t.Root = &Node[T]{}
+	t.nodes, t.keys = 0, 0
+	t.minimized = false
 }
 
 func countNodesBelow[T any](node *Node[T], mapping map[*Node[T]]int) int {
@@ -186,50 +2934,58 @@ func countNodesBelow[T any](node *Node[T], mapping map[*Node[T]]int) int {
 	return num
 }
 
-// PrintTrie recursively prints the prefix tree in a structured format
-// //TODO: tidy
+// PrintTrie prints the prefix tree below node in the same layout as the `tree` command. End nodes are marked with '*'.
+// Vertical bars are only drawn for ancestors that still have siblings left to print.
+// offset is no longer used and is kept for compatibility.
 func PrintTrie[T any](node *Node[T], prefix string, offset int, isLast bool) string {
 	if node == nil {
 		return ""
 	}
-	str := ""
+	var s strings.Builder
+	// writing to a strings.Builder never fails
+	_ = printNode(&s, node, prefix, isLast)
+	return s.String()
+}
+
+// Pretty returns the rendered tree of the trie, see PrintTrie.
+func (t *Trie[T]) Pretty() string {
+	return PrintTrie(t.Root, "", 0, true)
+}
+
+// Fprint writes the same rendering as Pretty to w one line at a time, without building it in memory first.
+// It stops at the first error returned by w.
+func (t *Trie[T]) Fprint(w io.Writer) error {
+	return printNode(w, t.Root, "", true)
+}
 
-	// Print the current node
+func printNode[T any](w io.Writer, node *Node[T], prefix string, isLast bool) error {
+	var line strings.Builder
+	childPrefix := prefix
+	// root node has no rune and is not connected to anything
 	if node.KeyRune != 0 {
-		offset += 4
 		if isLast {
-
-			str += fmt.Sprintf("%s└── %c", prefix, node.KeyRune)
-			for i := 0; i < 4; i++ {
-				if i%offset == 4 {
-					prefix += "|"
-					continue
-				}
-				prefix += " "
-			}
+			line.WriteString(prefix + "└── ")
+			childPrefix += "    "
 		} else {
-			str += fmt.Sprintf("%s├── %c", prefix, node.KeyRune)
-			// prefix = ""
-			for i := 0; i < 4; i++ {
-				if i%offset == 0 {
-					prefix += "|"
-					continue
-				}
-				prefix += " "
-			}
-			// prefix += "│   "
+			line.WriteString(prefix + "├── ")
+			childPrefix += "|   "
 		}
+		line.WriteRune(node.KeyRune)
 	}
 	if node.IsEnd {
-		str += "*"
+		line.WriteString("*")
+	}
+	line.WriteString("\n")
+	if _, err := io.WriteString(w, line.String()); err != nil {
+		return err
 	}
-	str += "\n"
 
-	// Recursively print the children
 	for i, child := range node.Children {
-		str += PrintTrie(child, prefix, offset, i == len(node.Children)-1)
+		if err := printNode(w, child, childPrefix, i == len(node.Children)-1); err != nil {
+			return err
+		}
 	}
-	return str
+	return nil
 }
 
 func leftPad(amount int, char rune) string {
@@ -240,26 +2996,145 @@ func leftPad(amount int, char rune) string {
 	return s.String()
 }
 
-// DepthFirstSearchWord() traverses every node in the trie and calls endNodeFun() when it reaches a end node, that is a key.
-// endNodeFun() parameters are the end *Node, the key for this Node, and the accumulator which is a value that is passed to every end Node.
-// Accumulator allows DepthFirstSearchWord to perform an operations and return some value, such as count keys in trie.
-func DepthFirstSearchWord[T, A any](nodes []*Node[T], keys []rune, endNodeFun func(*Node[T], string, A) A, accumulator A) A {
-	if len(nodes) == 0 {
-		// slog.Debug("no children nodes, reached end of subtree", "accumulator", accumulator)
-		return accumulator
+// AppendValue appends elem to the slice stored at key, storing a one-element slice if key is not in the trie,
+// which makes a Trie[[]V] a simple multimap. A trie made with WithMerge(func(a, b []V) []V { return append(a, b...) })
+// does the same for Insert.
+func AppendValue[V any](t *Trie[[]V], key string, elem V) error {
+	runes, err := t.prepareWrite([]rune(key))
+	if err != nil {
+		return keyError(key, err)
+	}
+	if node := search(t.Root, runes); node != nil && node.IsEnd {
+		node.Value = append(node.Value, elem)
+		return nil
+	}
+	_, err = t.insertKey(runes, []V{elem})
+	return keyError(key, err)
+}
+
+// CommonKeys returns, in lexicographic order, the keys found in both t and other, which may hold different values.
+// Both tries are walked together, only descending where both have a child for the same rune,
+// so disjoint parts of either trie are never visited.
+func CommonKeys[T, U any](t *Trie[T], other *Trie[U]) []string {
+	return commonKeys(t.Root, other.Root, []rune{}, []string{})
+}
+
+func commonKeys[T, U any](a *Node[T], b *Node[U], keys []rune, accumulator []string) []string {
+	if a.IsEnd && b.IsEnd {
+		accumulator = append(accumulator, string(keys))
+	}
+	// children are sorted, so matching ones are found by merging the two lists
+	for i, j := 0, 0; i < len(a.Children) && j < len(b.Children); {
+		switch ar, br := a.Children[i].KeyRune, b.Children[j].KeyRune; {
+		case ar < br:
+			i++
+		case ar > br:
+			j++
+		default:
+			accumulator = commonKeys(a.Children[i], b.Children[j], append(keys, ar), accumulator)
+			i++
+			j++
+		}
+	}
+	return accumulator
+}
+
+// Similarity returns the Jaccard similarity of the keys of t and other: the number of keys in both
+// divided by the number of keys in either, from 0 for disjoint tries to 1 for tries holding the same keys.
+// Two empty tries are identical, so they score 1. Values are ignored.
+// Shared keys are counted by walking both tries together like CommonKeys, without building any key.
+func (t *Trie[T]) Similarity(other *Trie[T]) float64 {
+	common := countCommonKeys(t.Root, other.Root)
+	union := t.Len() + other.Len() - common
+	if union == 0 {
+		return 1
+	}
+	return float64(common) / float64(union)
+}
+
+// countCommonKeys returns the number of keys below both a and b, see commonKeys
+func countCommonKeys[T, U any](a *Node[T], b *Node[U]) int {
+	count := 0
+	if a.IsEnd && b.IsEnd {
+		count++
+	}
+	for i, j := 0, 0; i < len(a.Children) && j < len(b.Children); {
+		switch ar, br := a.Children[i].KeyRune, b.Children[j].KeyRune; {
+		case ar < br:
+			i++
+		case ar > br:
+			j++
+		default:
+			count += countCommonKeys(a.Children[i], b.Children[j])
+			i++
+			j++
+		}
 	}
+	return count
+}
 
-	for _, node := range nodes {
-		slog.Debug("node", "val", node)
-		keys := append(keys, node.KeyRune)
+// CollectAll returns project(key, value) for every key in the trie, in lexicographic order of the keys,
+// collected in the same traversal as GetAll.
+func CollectAll[T, R any](t *Trie[T], project func(key string, value T) R) []R {
+	endNodeFun := func(node *Node[T], key string, accumulator []R) []R {
+		return append(accumulator, project(key, node.Value))
+	}
+	return depthFirstSearchKeys(t.Root, endNodeFun, []R{})
+}
 
+// FoldKeys folds fn over every key and its value in lexicographic order, starting from init.
+// Unlike ReducePrefix, fn is also given the depth of the key, its length in runes.
+func FoldKeys[T, A any](t *Trie[T], init A, fn func(acc A, key string, value T, depth int) A) A {
+	accumulator := init
+	if t.Root.IsEnd {
+		accumulator = fn(accumulator, nodeKey(t.Root, nil), t.Root.Value, 0)
+	}
+	walkChildren(t.Root.Children, []rune{}, func(keys []rune, node *Node[T]) error {
 		if node.IsEnd {
-			// keys = append(keys, node.KeyRune)
-			accumulator = endNodeFun(node, string(keys), accumulator)
+			accumulator = fn(accumulator, nodeKey(node, keys), node.Value, len(keys))
 		}
-		// continue DFS to this node's children
-		accumulator = DepthFirstSearchWord(node.Children, keys, endNodeFun, accumulator)
+		return nil
+	})
+	return accumulator
+}
+
+// ReducePrefix folds fn over every key starting with prefix and its value, in lexicographic order, starting from init.
+func ReducePrefix[T, A any](t *Trie[T], prefix string, init A, fn func(acc A, key string, value T) A) A {
+	keys := t.preparePrefix(prefix)
+	node := search(t.Root, keys)
+	if node == nil {
+		return init
+	}
+	accumulator := init
+	if node.IsEnd {
+		accumulator = fn(accumulator, string(keys), node.Value)
+	}
+	endNodeFun := func(node *Node[T], key string, accumulator A) A {
+		return fn(accumulator, key, node.Value)
+	}
+	return DepthFirstSearchWord(node.Children, keys, endNodeFun, accumulator)
+}
+
+// depthFirstSearchKeys is like DepthFirstSearchWord over every key in the trie below root, including the empty key stored on root itself
+func depthFirstSearchKeys[T, A any](root *Node[T], endNodeFun func(*Node[T], string, A) A, accumulator A) A {
+	if root.IsEnd {
+		accumulator = endNodeFun(root, "", accumulator)
 	}
+	return DepthFirstSearchWord(root.Children, []rune{}, endNodeFun, accumulator)
+}
+
+// DepthFirstSearchWord() traverses every node in the trie and calls endNodeFun() when it reaches a end node, that is a key.
+// endNodeFun() parameters are the end *Node, the key for this Node, and the accumulator which is a value that is passed to every end Node.
+// Accumulator allows DepthFirstSearchWord to perform an operations and return some value, such as count keys in trie.
+func DepthFirstSearchWord[T, A any](nodes []*Node[T], keys []rune, endNodeFun func(*Node[T], string, A) A, accumulator A) A {
+	// emit a node before its children, so a key which prefixes longer keys is never skipped
+	// and keys come out in lexicographic order
+	walkChildren(nodes, keys, func(keys []rune, node *Node[T]) error {
+		if node.IsEnd {
+			accumulator = endNodeFun(node, nodeKey(node, keys), accumulator)
+		}
+		return nil
+	})
 	return accumulator
 }
 
@@ -277,8 +3152,6 @@ func depthFirstSearchEveryNode[T, A any](nodes []*Node[T], keys []rune, nodeFun
 	}
 
 	for i := range nodes {
-		slog.Debug("node", "val", nodes[i])
-
 		keys := append(keys, nodes[i].KeyRune)
 		accumulator = depthFirstSearchEveryNode(nodes[i].Children, keys, nodeFun, accumulator)
 		accumulator = nodeFun(&nodes[i], string(keys), accumulator)
@@ -286,18 +3159,31 @@ func depthFirstSearchEveryNode[T, A any](nodes []*Node[T], keys []rune, nodeFun
 	return accumulator
 }
 
-func breadthFirstSearch[T, A any](queue []*Node[T], keys []rune, nodeFun func([]*Node[T], int, int, string, A) A, accumulator A) ([]*Node[T], A) {
-	currentQueueLen := len(queue)
-	currentLevel := 0
-	for i := 0; i < len(queue); i++ {
-		if i == currentQueueLen {
-			currentQueueLen = len(queue)
-			currentLevel++
+// breadthFirstSearch visits the nodes in queue and every node below them level by level, lexicographically within a level.
+// nodeFun is called with each node, its level, where the starting nodes are level 0, and its key, where the starting nodes
+// are at keys. Each node carries its own key and level in the queue, so neither depends on how long the queue grows.
+// It stops at the first error returned by nodeFun, and returns it along with the accumulator so far.
+func breadthFirstSearch[T, A any](queue []*Node[T], keys []rune, nodeFun func(*Node[T], int, string, A) (A, error), accumulator A) (A, error) {
+	type item struct {
+		node  *Node[T]
+		keys  []rune
+		level int
+	}
+	items := make([]item, 0, len(queue))
+	for _, node := range queue {
+		items = append(items, item{node: node, keys: keys})
+	}
+	for len(items) > 0 {
+		current := items[0]
+		items = items[1:]
+		var err error
+		if accumulator, err = nodeFun(current.node, current.level, string(current.keys), accumulator); err != nil {
+			return accumulator, err
+		}
+		for _, child := range current.node.Children {
+			keys := append(slices.Clip(current.keys), child.KeyRune)
+			items = append(items, item{node: child, keys: keys, level: current.level + 1})
 		}
-		acc := nodeFun(queue, i, currentLevel, string(keys), accumulator)
-		accumulator = acc
-		queue = append(queue, queue[i].Children...)
 	}
-
-	return queue, accumulator
+	return accumulator, nil
 }
@@ -1,13 +1,34 @@
 package trie
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/maphash"
 	"log/slog"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
 )
 
+var update = flag.Bool("update", false, "update golden files")
+
 func TestTrieInsert(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelDebug,
@@ -57,7 +78,7 @@ func TestTrieInsert(t *testing.T) {
 		err := trie.Insert(word, "")
 		assert.Equal(t, nil, err, "expected no errors on insert")
 		err = trie.Insert(word2, "")
-		assert.Equal(t, ErrAlreadyExists, err, "expected an error inserting the same word")
+		assert.ErrorIs(t, err, ErrAlreadyExists, "expected an error inserting the same word")
 
 		values := trie.GetAll()
 		expected := []string{word}
@@ -101,9 +122,27 @@ func TestTrieSearch(t *testing.T) {
 		assert.Equal(t, nil, err, "expected no errors on insert")
 
 		got, err := trie.Search(search)
-		assert.Equal(t, ErrNotFound, err)
+		assert.ErrorIs(t, err, ErrNotFound)
 		assert.Equal(t, "", got)
 	})
+	t.Run("diverging key that ends on another key returns err", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("hex", "ok")
+
+		_, err := trie.Search("hxx")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = trie.Search("hel")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("find multi-byte keys", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("café", "ok")
+
+		got, err := trie.Search("café")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "ok", got)
+	})
 }
 
 func TestTrieClear(t *testing.T) {
@@ -135,6 +174,13 @@ func TestTrieClear(t *testing.T) {
 		assert.ElementsMatch(t, []string{}, got2)
 		assert.Equal(t, 0, len(trie.Root.Children))
 	})
+	t.Run("clear does not traverse the trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		poisonChildren(search(trie.Root, []rune("caat")))
+
+		assert.NotPanics(t, trie.Clear)
+		assert.Equal(t, 0, trie.Len())
+	})
 }
 
 func TestTrieDelete(t *testing.T) {
@@ -189,14 +235,15 @@ func TestTrieDelete(t *testing.T) {
 		trie.Insert(word, val)
 		got, err := trie.Delete("what")
 		assert.Equal(t, "", got)
-		assert.Equal(t, ErrNotFound, err)
+		assert.ErrorIs(t, err, ErrNotFound)
 
 		values := trie.GetAll()
 		assert.ElementsMatch(t, []string{word}, values)
 	})
 }
 
-func TestTrieVisualize(t *testing.T) {
+// newFixtureTrie returns a trie with overlapping keys of various depths
+func newFixtureTrie() *Trie[string] {
 	trie := NewTrie[string]()
 	val := "ok"
 	trie.Insert("caat", val)
@@ -209,8 +256,4239 @@ func TestTrieVisualize(t *testing.T) {
 	trie.Insert("as", val)
 	trie.Insert("ask", val)
 	trie.Insert("at", val)
+	return trie
+}
+
+// poisonChildren appends a nil child to node, so any traversal visiting node's children panics.
+// Asserting that a method doesn't panic then proves it never reaches them, such as a walk stopping early.
+func poisonChildren[T any](node *Node[T]) {
+	node.Children = append(node.Children, nil)
+}
+
+// newTrieOfKeys returns a trie holding keys, each with its index in keys as its value
+func newTrieOfKeys(keys ...string) *Trie[int] {
+	trie := NewTrie[int]()
+	for i, key := range keys {
+		trie.Insert(key, i)
+	}
+	return trie
+}
+
+func TestTrieVisualize(t *testing.T) {
+	trie := newFixtureTrie()
+	str := trie.Pretty()
+	golden := filepath.Join("testdata", "visualize.golden")
+	if *update {
+		err := os.WriteFile(golden, []byte(str), 0o644)
+		assert.Equal(t, nil, err)
+	}
+	expected, err := os.ReadFile(golden)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, string(expected), str)
+	assert.Equal(t, str, PrintTrie(trie.Root, "", 0, true))
+}
+
+func TestTrieToMap(t *testing.T) {
+	t.Run("empty trie returns empty map", func(t *testing.T) {
+		trie := NewTrie[int]()
+		got := trie.ToMap()
+		assert.Equal(t, map[string]int{}, got)
+		assert.Equal(t, 0, trie.Len())
+	})
+	t.Run("map holds every key and value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("hel", 1)
+		trie.Insert("hello", 2)
+		trie.Insert("help", 3)
+		trie.Insert("world", 4)
+
+		got := trie.ToMap()
+		expected := map[string]int{"hel": 1, "hello": 2, "help": 3, "world": 4}
+		assert.Equal(t, expected, got)
+		assert.Equal(t, trie.Len(), len(got))
+	})
+}
+
+func TestNewTrieFromMap(t *testing.T) {
+	t.Run("round trip through ToMap", func(t *testing.T) {
+		m := map[string]int{"hel": 1, "hello": 2, "help": 3, "world": 4}
+		trie, err := NewTrieFromMap(m)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, m, trie.ToMap())
+	})
+	t.Run("empty map builds empty trie", func(t *testing.T) {
+		trie, err := NewTrieFromMap(map[string]string{})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 0, trie.Len())
+	})
+}
+
+// permutations returns every ordering of words
+func permutations(words []string) [][]string {
+	if len(words) <= 1 {
+		return [][]string{append([]string{}, words...)}
+	}
+	result := [][]string{}
+	for i := range words {
+		rest := append(append([]string{}, words[:i]...), words[i+1:]...)
+		for _, perm := range permutations(rest) {
+			result = append(result, append([]string{words[i]}, perm...))
+		}
+	}
+	return result
+}
+
+// countOrphans counts nodes below root which are neither a key nor lead to one
+func countOrphans[T any](node *Node[T]) int {
+	count := 0
+	for _, child := range node.Children {
+		if len(child.Children) == 0 && !child.IsEnd {
+			count++
+		}
+		count += countOrphans(child)
+	}
+	return count
+}
+
+func TestTrieDeleteMatrix(t *testing.T) {
+	words := []string{"he", "hel", "hello", "help"}
+	for _, insertOrder := range permutations(words) {
+		for _, deleteOrder := range permutations(words) {
+			trie := NewTrie[string]()
+			for _, word := range insertOrder {
+				assert.Equal(t, nil, trie.Insert(word, word))
+			}
+			remaining := append([]string{}, words...)
+			for _, word := range deleteOrder {
+				got, err := trie.Delete(word)
+				assert.Equal(t, nil, err, "insert order %v, delete order %v", insertOrder, deleteOrder)
+				assert.Equal(t, word, got)
+
+				remaining = slices.DeleteFunc(remaining, func(s string) bool { return s == word })
+				assert.ElementsMatch(t, remaining, trie.GetAll(), "insert order %v, delete order %v", insertOrder, deleteOrder)
+				assert.Equal(t, 0, countOrphans(trie.Root), "insert order %v, delete order %v", insertOrder, deleteOrder)
+			}
+			assert.Equal(t, 0, len(trie.Root.Children))
+		}
+	}
+
+	t.Run("deleting a prefix that is not a key returns error", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		got, err := trie.Delete("hel")
+		assert.Equal(t, "", got)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ElementsMatch(t, []string{"hello"}, trie.GetAll())
+	})
+	t.Run("re-insert a deleted overlapping key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("hel", "ok")
+		trie.Delete("hel")
+		trie.Delete("hello")
+		assert.Equal(t, nil, trie.Insert("hel", "new"))
+		got, err := trie.Search("hel")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "new", got)
+		assert.ElementsMatch(t, []string{"hel"}, trie.GetAll())
+		assert.Equal(t, 0, countOrphans(trie.Root))
+	})
+}
+
+func TestTrieContains(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("hello", "ok")
+	trie.Insert("hel", "ok")
+	trie.Insert("world", "ok")
+
+	t.Run("present keys", func(t *testing.T) {
+		assert.True(t, trie.Contains("hello"))
+		assert.True(t, trie.Contains("hel"))
+		assert.True(t, trie.Contains("world"))
+	})
+	t.Run("absent keys", func(t *testing.T) {
+		assert.False(t, trie.Contains("help"))
+		assert.False(t, trie.Contains("hello2"))
+		assert.False(t, trie.Contains("x"))
+	})
+	t.Run("prefix-only keys", func(t *testing.T) {
+		assert.False(t, trie.Contains("he"))
+		assert.False(t, trie.Contains("wor"))
+	})
+}
+
+func TestTrieDryRunInsert(t *testing.T) {
+	t.Run("new and existing keys", func(t *testing.T) {
+		trie := newFixtureTrie()
+		before, nodes := trie.ToMap(), trie.NodeCount()
+		added, duplicates := trie.DryRunInsert([]string{"cat", "caat", "as", "dog", "ca", "cat", "", "at"})
+		assert.Equal(t, []string{"cat", "dog", "ca", ""}, added)
+		assert.Equal(t, []string{"caat", "as", "cat", "at"}, duplicates)
+		assert.Equal(t, before, trie.ToMap())
+		assert.Equal(t, nodes, trie.NodeCount())
+
+		// the preview matches what inserting the keys does
+		for _, key := range added {
+			assert.Nil(t, trie.Insert(key, "new"), key)
+		}
+		for _, key := range duplicates {
+			assert.ErrorIs(t, trie.Insert(key, "new"), ErrAlreadyExists, key)
+		}
+	})
+	t.Run("normalized and invalid keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[int](strings.ToLower), WithMaxKeyLen[int](4))
+		trie.Insert("cat", 1)
+		added, duplicates := trie.DryRunInsert([]string{"CAT", "Dog", "dog", "horse"})
+		assert.Equal(t, []string{"Dog"}, added)
+		assert.Equal(t, []string{"CAT", "dog"}, duplicates)
+	})
+	t.Run("empty batch", func(t *testing.T) {
+		added, duplicates := newFixtureTrie().DryRunInsert(nil)
+		assert.Equal(t, []string{}, added)
+		assert.Equal(t, []string{}, duplicates)
+	})
+}
+
+func TestTrieMinMaxKey(t *testing.T) {
+	t.Run("empty trie has no min or max", func(t *testing.T) {
+		trie := NewTrie[string]()
+		_, ok := trie.MinKey()
+		assert.False(t, ok)
+		_, ok = trie.MaxKey()
+		assert.False(t, ok)
+	})
+	t.Run("min key is a prefix of another key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("world", "ok")
+		trie.Insert("hel", "ok")
+		trie.Insert("help", "ok")
+
+		got, ok := trie.MinKey()
+		assert.True(t, ok)
+		assert.Equal(t, "hel", got)
+		got, ok = trie.MaxKey()
+		assert.True(t, ok)
+		assert.Equal(t, "world", got)
+	})
+	t.Run("max key extends another key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("ab", "ok")
+		trie.Insert("abc", "ok")
+		trie.Insert("aa", "ok")
+
+		got, ok := trie.MinKey()
+		assert.True(t, ok)
+		assert.Equal(t, "aa", got)
+		got, ok = trie.MaxKey()
+		assert.True(t, ok)
+		assert.Equal(t, "abc", got)
+	})
+}
+
+func TestTrieSample(t *testing.T) {
+	trie := NewTrie[int]()
+	words := benchmarkWords(100)
+	for i, word := range words {
+		trie.Insert(word, i)
+	}
+
+	t.Run("sample size", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(1, 2))
+		sample := trie.Sample(10, rng)
+		assert.Equal(t, 10, len(sample))
+		for _, key := range sample {
+			assert.True(t, trie.Contains(key), key)
+		}
+		slices.Sort(sample)
+		assert.Equal(t, 10, len(slices.Compact(sample)))
+
+		assert.ElementsMatch(t, trie.GetAll(), trie.Sample(1000, rng))
+		assert.Equal(t, []string{}, trie.Sample(0, rng))
+		assert.Equal(t, []string{}, NewTrie[int]().Sample(5, rng))
+	})
+	t.Run("same seed gives the same sample", func(t *testing.T) {
+		first := trie.Sample(10, rand.New(rand.NewPCG(1, 2)))
+		second := trie.Sample(10, rand.New(rand.NewPCG(1, 2)))
+		assert.Equal(t, first, second)
+		assert.NotEqual(t, first, trie.Sample(10, rand.New(rand.NewPCG(3, 4))))
+	})
+	t.Run("roughly uniform", func(t *testing.T) {
+		small := NewTrie[int]()
+		for i, key := range []string{"a", "ab", "abc", "b", "ba", "c", "cab", "d", "da", "dab"} {
+			small.Insert(key, i)
+		}
+		rng := rand.New(rand.NewPCG(5, 6))
+		counts := map[string]int{}
+		draws := 10000
+		for range draws {
+			for _, key := range small.Sample(3, rng) {
+				counts[key]++
+			}
+		}
+		// every key should be drawn in 3 of 10 samples
+		for _, key := range small.GetAll() {
+			assert.InDelta(t, 3000, counts[key], 300, key)
+		}
+	})
+}
+
+func TestTrieKeysInRange(t *testing.T) {
+	trie := NewTrie[string]()
+	for _, word := range []string{"world", "hello", "help", "hel", "apple", "ape", "zoo"} {
+		trie.Insert(word, "ok")
+	}
+
+	t.Run("keys are sorted and range is half-open", func(t *testing.T) {
+		got := trie.KeysInRange("ape", "help")
+		assert.Equal(t, []string{"ape", "apple", "hel", "hello"}, got)
+	})
+	t.Run("bounds need not be keys", func(t *testing.T) {
+		got := trie.KeysInRange("b", "x")
+		assert.Equal(t, []string{"hel", "hello", "help", "world"}, got)
+	})
+	t.Run("whole trie", func(t *testing.T) {
+		got := trie.KeysInRange("", "zzz")
+		assert.Equal(t, []string{"ape", "apple", "hel", "hello", "help", "world", "zoo"}, got)
+	})
+	t.Run("empty ranges", func(t *testing.T) {
+		assert.Equal(t, []string{}, trie.KeysInRange("help", "help"))
+		assert.Equal(t, []string{}, trie.KeysInRange("z", "a"))
+		assert.Equal(t, []string{}, trie.KeysInRange("b", "c"))
+	})
+}
+
+func TestTrieStats(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		stats := NewTrie[string]().Stats()
+		assert.Equal(t, 0, stats.Nodes)
+		assert.Equal(t, 0, stats.Keys)
+		assert.Equal(t, 0, stats.MaxDepth)
+		assert.Equal(t, 0.0, stats.AvgBranching)
+	})
+	t.Run("fixture trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		stats := trie.Stats()
+		assert.Equal(t, 16, stats.Nodes)
+		assert.Equal(t, countNodesBelow(trie.Root, map[*Node[string]]int{}), stats.Nodes)
+		assert.Equal(t, 10, stats.Keys)
+		assert.Equal(t, trie.Len(), stats.Keys)
+		assert.Equal(t, 6, stats.MaxDepth)
+		assert.InDelta(t, 1.6, stats.AvgBranching, 1e-9)
+		assert.Greater(t, stats.EstimatedBytes, uintptr(0))
+	})
+}
+
+func TestTrieIterFrom(t *testing.T) {
+	trie := newFixtureTrie()
+	trie.Insert("", "root")
+	all := trie.GetAll()
+	collect := func(start string) []string {
+		keys := []string{}
+		for key, value := range trie.IterFrom(start) {
+			want, _ := trie.Search(key)
+			assert.Equal(t, want, value, key)
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	t.Run("from a key in the middle", func(t *testing.T) {
+		i := slices.Index(all, "caab")
+		assert.Equal(t, all[i:], collect("caab"))
+		assert.Equal(t, []string{"caab", "caable", "caalc", "caalcr", "caalcu", "caalm", "caat"}, collect("caab"))
+	})
+	t.Run("from between keys", func(t *testing.T) {
+		assert.Equal(t, []string{"caalc", "caalcr", "caalcu", "caalm", "caat"}, collect("caabz"))
+		assert.Equal(t, []string{"caalcu", "caalm", "caat"}, collect("caalcs"))
+		assert.Equal(t, []string{"caab", "caable"}, collect("caa")[:2])
+		assert.Equal(t, []string{}, collect("d"))
+	})
+	t.Run("from the start", func(t *testing.T) {
+		assert.Equal(t, all, collect(""))
+		assert.Equal(t, all[1:], collect("\x01"))
+	})
+	t.Run("stops with the loop", func(t *testing.T) {
+		keys := []string{}
+		for key := range trie.IterFrom("as") {
+			keys = append(keys, key)
+			if len(keys) == 3 {
+				break
+			}
+		}
+		assert.Equal(t, []string{"as", "ask", "at"}, keys)
+	})
+	t.Run("empty trie", func(t *testing.T) {
+		for range NewTrie[int]().IterFrom("") {
+			t.Fatal("empty trie yielded a key")
+		}
+	})
+}
+
+func TestTrieSuggestN(t *testing.T) {
+	trie := newFixtureTrie()
+
+	t.Run("returns at most n keys in order", func(t *testing.T) {
+		assert.Equal(t, []string{"caab", "caable"}, trie.SuggestN("caa", 2))
+		assert.Equal(t, []string{"as", "ask", "at"}, trie.SuggestN("a", 10))
+	})
+	t.Run("prefix that is a key is included", func(t *testing.T) {
+		assert.Equal(t, []string{"caalc", "caalcr"}, trie.SuggestN("caalc", 2))
+	})
+	t.Run("absent prefix or non-positive n returns nothing", func(t *testing.T) {
+		assert.Equal(t, []string{}, trie.SuggestN("x", 10))
+		assert.Equal(t, []string{}, trie.SuggestN("a", 0))
+	})
+	t.Run("limit short-circuits traversal", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("aa", "ok")
+		trie.Insert("ab", "ok")
+		trie.Insert("ac", "ok")
+		// the walk must stop before the children of "ac"
+		poisonChildren(search(trie.Root, []rune("ac")))
+
+		assert.NotPanics(t, func() {
+			assert.Equal(t, []string{"aa", "ab"}, trie.SuggestN("", 2))
+		})
+	})
+}
+
+func TestTriePrefixSearch(t *testing.T) {
+	trie := newFixtureTrie()
+	assert.Equal(t, []string{"caab", "caable", "caalc", "caalcr", "caalcu", "caalm", "caat"}, trie.PrefixSearch("ca"))
+	assert.Equal(t, []string{"ask"}, trie.PrefixSearch("ask"))
+	assert.Equal(t, []string{}, trie.PrefixSearch("cb"))
+	assert.Equal(t, 10, len(trie.PrefixSearch("")))
+}
+
+func TestTrieDeleteIf(t *testing.T) {
+	t.Run("delete keys matching predicate", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("hel", 1)
+		trie.Insert("hello", 20)
+		trie.Insert("help", 3)
+		trie.Insert("world", 40)
+		trie.Insert("wor", 5)
+
+		removed := trie.DeleteIf(func(key string, value int) bool { return value >= 10 })
+		assert.Equal(t, 2, removed)
+		assert.Equal(t, map[string]int{"hel": 1, "help": 3, "wor": 5}, trie.ToMap())
+		assert.Equal(t, 0, countOrphans(trie.Root))
+		// "hello" and "world" leave nodes "lo" and "ld" behind which must be pruned
+		assert.Equal(t, 7, countNodesBelow(trie.Root, map[*Node[int]]int{}))
+	})
+	t.Run("delete every key empties trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		removed := trie.DeleteIf(func(key string, value string) bool { return true })
+		assert.Equal(t, 10, removed)
+		assert.Equal(t, []string{}, trie.GetAll())
+		assert.Equal(t, 0, len(trie.Root.Children))
+	})
+	t.Run("predicate receives keys", func(t *testing.T) {
+		trie := newFixtureTrie()
+		removed := trie.DeleteIf(func(key string, value string) bool { return strings.HasPrefix(key, "caal") })
+		assert.Equal(t, 4, removed)
+		assert.ElementsMatch(t, []string{"caat", "caab", "caable", "as", "ask", "at"}, trie.GetAll())
+		assert.Equal(t, 0, countOrphans(trie.Root))
+	})
+	t.Run("no match removes nothing", func(t *testing.T) {
+		trie := newFixtureTrie()
+		removed := trie.DeleteIf(func(key string, value string) bool { return false })
+		assert.Equal(t, 0, removed)
+		assert.Equal(t, 10, trie.Len())
+	})
+}
+
+func TestTrieWalk(t *testing.T) {
+	t.Run("visit every key in order", func(t *testing.T) {
+		trie := newFixtureTrie()
+		got := []string{}
+		err := trie.Walk(func(key string, value string) error {
+			got = append(got, key)
+			return nil
+		})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"as", "ask", "at", "caab", "caable", "caalc", "caalcr", "caalcu", "caalm", "caat"}, got)
+	})
+	t.Run("error stops the walk", func(t *testing.T) {
+		trie := newFixtureTrie()
+		stop := errors.New("stop")
+		calls := 0
+		err := trie.Walk(func(key string, value string) error {
+			calls++
+			if key == "at" {
+				return stop
+			}
+			return nil
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 3, calls)
+	})
+}
+
+func TestTrieWalkContext(t *testing.T) {
+	t.Run("cancel mid traversal", func(t *testing.T) {
+		trie := newFixtureTrie()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		calls := 0
+		err := trie.WalkContext(ctx, func(key string, value string) error {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return nil
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("already cancelled context visits nothing", func(t *testing.T) {
+		trie := newFixtureTrie()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		calls := 0
+		err := trie.WalkContext(ctx, func(key string, value string) error {
+			calls++
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, calls)
+	})
+}
+
+func TestTriePrune(t *testing.T) {
+	t.Run("healthy trie has nothing to prune", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, 0, trie.Prune())
+		assert.Equal(t, 10, trie.Len())
+	})
+	t.Run("remove orphaned chains", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("help", "ok")
+		trie.Insert("world", "ok")
+		// unmark keys without cleaning up, leaving "p" and "world" as orphans
+		search(trie.Root, []rune("help")).IsEnd = false
+		search(trie.Root, []rune("world")).IsEnd = false
+		// an orphan hanging off an end node
+		node := search(trie.Root, []rune("hello"))
+		node.Children = append(node.Children, &Node[string]{KeyRune: 'x'})
+
+		assert.Equal(t, 3, countOrphans(trie.Root))
+		assert.Equal(t, 7, trie.Prune())
+		assert.Equal(t, 0, countOrphans(trie.Root))
+		assert.Equal(t, []string{"hello"}, trie.GetAll())
+		assert.Equal(t, 5, countNodesBelow(trie.Root, map[*Node[string]]int{}))
+		assert.Equal(t, 0, trie.Prune())
+	})
+}
+
+func TestTrieSuffixSearch(t *testing.T) {
+	trie := NewTrie[string]()
+	for _, word := range []string{"sing", "singing", "ring", "bring", "rings", "king", "in"} {
+		trie.Insert(word, "ok")
+	}
+
+	assert.Equal(t, []string{"bring", "king", "ring", "sing", "singing"}, trie.SuffixSearch("ing"))
+	assert.Equal(t, []string{"bring", "ring"}, trie.SuffixSearch("ring"))
+	assert.Equal(t, []string{"rings"}, trie.SuffixSearch("s"))
+	assert.Equal(t, []string{}, trie.SuffixSearch("xyz"))
+	assert.Equal(t, 7, len(trie.SuffixSearch("")))
+}
+
+func TestTrieRunes(t *testing.T) {
+	trie := NewTrie[string]()
+	key := []rune("café")
+	err := trie.InsertRunes(key, "ok")
+	assert.Equal(t, nil, err)
+	assert.ErrorIs(t, trie.InsertRunes(key, "ok"), ErrAlreadyExists)
+
+	got, err := trie.SearchRunes(key)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "ok", got)
+	// string and rune entry points refer to the same keys
+	got, err = trie.Search("café")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "ok", got)
+
+	got, err = trie.DeleteRunes(key)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "ok", got)
+	_, err = trie.SearchRunes(key)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// benchmarkWords returns n distinct pseudo random lowercase words
+func benchmarkWords(n int) []string {
+	rng := rand.New(rand.NewPCG(1, 2))
+	seen := map[string]bool{}
+	words := make([]string, 0, n)
+	for len(words) < n {
+		word := make([]rune, 3+rng.IntN(8))
+		for i := range word {
+			word[i] = 'a' + rune(rng.IntN(26))
+		}
+		if !seen[string(word)] {
+			seen[string(word)] = true
+			words = append(words, string(word))
+		}
+	}
+	return words
+}
+
+func BenchmarkSearch(b *testing.B) {
+	words := benchmarkWords(10000)
+	trie := NewTrie[int]()
+	for i, word := range words {
+		trie.Insert(word, i)
+	}
+
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			trie.Search(words[i%len(words)])
+		}
+	})
+	b.Run("runes", func(b *testing.B) {
+		runeWords := make([][]rune, len(words))
+		for i, word := range words {
+			runeWords[i] = []rune(word)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			trie.SearchRunes(runeWords[i%len(words)])
+		}
+	})
+}
+
+func TestTrieAutoComplete(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("go", "https://go.dev")
+	trie.Insert("golang", "https://golang.org")
+	trie.Insert("gopher", "https://go.dev/blog/gopher")
+	trie.Insert("rust", "https://rust-lang.org")
+
+	t.Run("completions carry values", func(t *testing.T) {
+		got := trie.AutoComplete("go")
+		expected := []Entry[string]{
+			{Key: "go", Value: "https://go.dev"},
+			{Key: "golang", Value: "https://golang.org"},
+			{Key: "gopher", Value: "https://go.dev/blog/gopher"},
+		}
+		assert.Equal(t, expected, got)
+	})
+	t.Run("absent prefix", func(t *testing.T) {
+		assert.Equal(t, []Entry[string]{}, trie.AutoComplete("java"))
+	})
+}
+
+func TestTrieCommonPrefix(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		assert.Equal(t, "", NewTrie[string]().CommonPrefix())
+	})
+	t.Run("keys share a prefix", func(t *testing.T) {
+		trie := NewTrie[string]()
+		for _, word := range []string{"caalm", "caalc", "caalcu", "caalcr"} {
+			trie.Insert(word, "ok")
+		}
+		assert.Equal(t, "caal", trie.CommonPrefix())
+	})
+	t.Run("shared prefix is itself a key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("caalcu", "ok")
+		trie.Insert("caal", "ok")
+		assert.Equal(t, "caal", trie.CommonPrefix())
+	})
+	t.Run("single key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		assert.Equal(t, "hello", trie.CommonPrefix())
+	})
+	t.Run("keys diverge immediately", func(t *testing.T) {
+		assert.Equal(t, "", newFixtureTrie().CommonPrefix())
+	})
+}
+
+func TestTrieMinimalPrefixCover(t *testing.T) {
+	t.Run("clustered keys", func(t *testing.T) {
+		trie := newTrieOfKeys("api.example.com", "api.example.org", "cdn1.example.com", "cdn2.example.com", "mail.example.com")
+		cover := trie.MinimalPrefixCover()
+		assert.Equal(t, []string{"api.example.", "cdn", "mail.example.com"}, cover)
+	})
+	t.Run("every key has exactly one covering prefix", func(t *testing.T) {
+		trie := newFixtureTrie()
+		cover := trie.MinimalPrefixCover()
+		assert.Equal(t, []string{"a", "caa"}, cover)
+		for _, key := range trie.GetAll() {
+			covering := 0
+			for _, prefix := range cover {
+				if strings.HasPrefix(key, prefix) {
+					covering++
+				}
+			}
+			assert.Equal(t, 1, covering, key)
+		}
+	})
+	t.Run("a key ends the prefix", func(t *testing.T) {
+		assert.Equal(t, []string{"ca", "do"}, newTrieOfKeys("car", "cart", "cat", "dog", "door").MinimalPrefixCover())
+		assert.Equal(t, []string{"car"}, newTrieOfKeys("car", "cart", "carts").MinimalPrefixCover())
+	})
+	t.Run("empty key", func(t *testing.T) {
+		assert.Equal(t, []string{""}, newTrieOfKeys("", "a", "b").MinimalPrefixCover())
+		assert.Equal(t, []string{}, newTrieOfKeys().MinimalPrefixCover())
+	})
+}
+
+func TestTrieIsEmpty(t *testing.T) {
+	t.Run("fresh trie", func(t *testing.T) {
+		assert.True(t, NewTrie[string]().IsEmpty())
+	})
+	t.Run("populated trie", func(t *testing.T) {
+		assert.False(t, newFixtureTrie().IsEmpty())
+	})
+	t.Run("every key deleted", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("hel", "ok")
+		trie.Delete("hello")
+		assert.False(t, trie.IsEmpty())
+		trie.Delete("hel")
+		assert.True(t, trie.IsEmpty())
+	})
+	t.Run("cleared trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		trie.Clear()
+		assert.True(t, trie.IsEmpty())
+	})
+	t.Run("nodes without keys", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		search(trie.Root, []rune("hello")).IsEnd = false
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func TestTrieMaximalKeys(t *testing.T) {
+	t.Run("nested keys", func(t *testing.T) {
+		assert.Equal(t, []string{"abc"}, newTrieOfKeys("a", "ab", "abc").MaximalKeys())
+	})
+	t.Run("sibling keys", func(t *testing.T) {
+		assert.Equal(t, []string{"a", "b"}, newTrieOfKeys("a", "b").MaximalKeys())
+		assert.Equal(t, []string{"abc", "abd", "b"}, newTrieOfKeys("", "a", "abc", "abd", "b").MaximalKeys())
+	})
+	t.Run("fixture", func(t *testing.T) {
+		assert.Equal(t, []string{"ask", "at", "caable", "caalcr", "caalcu", "caalm", "caat"}, newFixtureTrie().MaximalKeys())
+	})
+	t.Run("empty key", func(t *testing.T) {
+		assert.Equal(t, []string{""}, newTrieOfKeys("").MaximalKeys())
+		assert.Equal(t, []string{}, newTrieOfKeys().MaximalKeys())
+	})
+	t.Run("soft deleted keys below don't count", func(t *testing.T) {
+		trie := newTrieOfKeys("a", "abc")
+		trie.SoftDelete("abc")
+		assert.Equal(t, []string{"a"}, trie.MaximalKeys())
+	})
+}
+
+func TestTrieNodeAt(t *testing.T) {
+	trie := newFixtureTrie()
+
+	t.Run("children are the prefix continuations", func(t *testing.T) {
+		node, ok := trie.NodeAt("caa")
+		assert.True(t, ok)
+		assert.Equal(t, 'a', node.KeyRune)
+		assert.False(t, node.IsEnd)
+		runes := []rune{}
+		for _, child := range node.Children {
+			runes = append(runes, child.KeyRune)
+		}
+		assert.ElementsMatch(t, []rune{'t', 'l', 'b'}, runes)
+	})
+	t.Run("node of a key", func(t *testing.T) {
+		node, ok := trie.NodeAt("as")
+		assert.True(t, ok)
+		assert.True(t, node.IsEnd)
+		assert.Equal(t, 1, len(node.Children))
+	})
+	t.Run("empty prefix is the root", func(t *testing.T) {
+		node, ok := trie.NodeAt("")
+		assert.True(t, ok)
+		assert.Equal(t, trie.Root, node)
+	})
+	t.Run("absent prefix", func(t *testing.T) {
+		node, ok := trie.NodeAt("cab")
+		assert.False(t, ok)
+		assert.Nil(t, node)
+	})
+}
+
+func TestTrieMaxKeyLen(t *testing.T) {
+	trie := NewTrieWithOptions(WithMaxKeyLen[string](5))
+
+	t.Run("keys below and at the limit", func(t *testing.T) {
+		assert.Equal(t, nil, trie.Insert("hel", "ok"))
+		assert.Equal(t, nil, trie.Insert("hello", "ok"))
+		_, err := trie.Search("hello")
+		assert.Equal(t, nil, err)
+	})
+	t.Run("limit counts runes not bytes", func(t *testing.T) {
+		assert.Equal(t, nil, trie.Insert("cafés", "ok"))
+	})
+	t.Run("keys above the limit", func(t *testing.T) {
+		assert.ErrorIs(t, trie.Insert("hello!", "ok"), ErrKeyTooLong)
+		_, err := trie.Search("hello!")
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+		_, err = trie.Delete("hello!")
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+		assert.ElementsMatch(t, []string{"hel", "hello", "cafés"}, trie.GetAll())
+	})
+	t.Run("no limit by default", func(t *testing.T) {
+		trie := NewTrie[string]()
+		assert.Equal(t, nil, trie.Insert(strings.Repeat("a", 1000), "ok"))
+	})
+}
+
+func TestTrieLongKey(t *testing.T) {
+	trie := NewTrie[string]()
+	key := strings.Repeat("ab", 500000)
+
+	assert.NotPanics(t, func() {
+		assert.Equal(t, nil, trie.Insert(key, "ok"))
+		got, err := trie.Search(key)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "ok", got)
+		assert.True(t, trie.Contains(key))
+
+		got, err = trie.Delete(key)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "ok", got)
+		assert.Equal(t, 0, len(trie.Root.Children))
+	})
+}
+
+func TestTrieDeepTraversal(t *testing.T) {
+	trie := NewTrie[int]()
+	key := strings.Repeat("a", 1000000)
+	trie.Insert(key, 1)
+	trie.Insert(key[:10], 2)
+	trie.Insert(key[:10]+"b", 3)
+
+	// traversals keep their own stack, so they fit in a goroutine stack far smaller than the trie is deep
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	assert.NotPanics(t, func() {
+		keys := trie.GetAll()
+		assert.Equal(t, []string{key[:10], key, key[:10] + "b"}, keys)
+		assert.Equal(t, 3, trie.Len())
+
+		walked := 0
+		trie.Walk(func(k string, value int) error {
+			walked++
+			return nil
+		})
+		assert.Equal(t, 3, walked)
+	})
+}
+
+func TestTrieSequence(t *testing.T) {
+	t.Run("sequence increases with each insert", func(t *testing.T) {
+		trie := NewTrie[string]()
+		words := []string{"hello", "hel", "world", "help"}
+		for _, word := range words {
+			trie.Insert(word, "ok")
+		}
+		last := uint64(0)
+		for _, word := range words {
+			seq, ok := trie.Sequence(word)
+			assert.True(t, ok)
+			assert.Greater(t, seq, last)
+			last = seq
+		}
+	})
+	t.Run("failed inserts and searches do not change sequence", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		before, _ := trie.Sequence("hello")
+		assert.ErrorIs(t, trie.Insert("hello", "ok"), ErrAlreadyExists)
+		trie.Search("hello")
+		after, _ := trie.Sequence("hello")
+		assert.Equal(t, before, after)
+
+		trie.Insert("world", "ok")
+		seq, _ := trie.Sequence("world")
+		assert.Equal(t, before+1, seq)
+	})
+	t.Run("re-inserted key gets a new sequence", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("world", "ok")
+		first, _ := trie.Sequence("hello")
+		trie.Delete("hello")
+		_, ok := trie.Sequence("hello")
+		assert.False(t, ok)
+
+		trie.Insert("hello", "ok")
+		second, _ := trie.Sequence("hello")
+		other, _ := trie.Sequence("world")
+		assert.Greater(t, second, first)
+		assert.Greater(t, second, other)
+	})
+	t.Run("prefix of a key has no sequence", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		_, ok := trie.Sequence("hel")
+		assert.False(t, ok)
+	})
+}
+
+func TestTrieDeleteAll(t *testing.T) {
+	t.Run("mix of existing and missing keys", func(t *testing.T) {
+		trie := newFixtureTrie()
+		errs := trie.DeleteAll([]string{"caat", "missing", "as", "caa", "caalc"})
+		assert.Equal(t, map[string]error{
+			"missing": &KeyError{Key: "missing", Err: ErrNotFound},
+			"caa":     &KeyError{Key: "caa", Err: ErrNotFound},
+		}, errs)
+		assert.ElementsMatch(t, []string{"caalm", "caalcu", "caalcr", "caab", "caable", "ask", "at"}, trie.GetAll())
+	})
+	t.Run("deleting the same key twice reports the second", func(t *testing.T) {
+		trie := newFixtureTrie()
+		errs := trie.DeleteAll([]string{"at", "at"})
+		assert.Equal(t, map[string]error{"at": &KeyError{Key: "at", Err: ErrNotFound}}, errs)
+	})
+	t.Run("all deleted", func(t *testing.T) {
+		trie := newFixtureTrie()
+		errs := trie.DeleteAll(trie.GetAll())
+		assert.Equal(t, map[string]error{}, errs)
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func TestTrieWalkNodes(t *testing.T) {
+	t.Run("visit every node", func(t *testing.T) {
+		trie := newFixtureTrie()
+		count := 0
+		trie.WalkNodes(func(path string, node *Node[string]) {
+			count++
+		})
+		assert.Equal(t, countNodesBelow(trie.Root, map[*Node[string]]int{}), count)
+	})
+	t.Run("paths lead to their nodes", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("ab", "ok")
+		trie.Insert("ac", "ok")
+		paths := []string{}
+		trie.WalkNodes(func(path string, node *Node[string]) {
+			paths = append(paths, path)
+			got, ok := trie.NodeAt(path)
+			assert.True(t, ok)
+			assert.Equal(t, got, node)
+		})
+		assert.Equal(t, []string{"a", "ab", "ac"}, paths)
+	})
+	t.Run("empty trie visits nothing", func(t *testing.T) {
+		NewTrie[string]().WalkNodes(func(path string, node *Node[string]) {
+			t.Fatal("unexpected node")
+		})
+	})
+}
+
+func TestTrieWalkBranchPoints(t *testing.T) {
+	branchPoints := func(trie *Trie[string]) []string {
+		prefixes := []string{}
+		trie.WalkBranchPoints(func(prefix string, node *Node[string]) {
+			assert.True(t, node.IsEnd || len(node.Children) > 1, prefix)
+			prefixes = append(prefixes, prefix)
+		})
+		return prefixes
+	}
+
+	t.Run("single child chains skipped", func(t *testing.T) {
+		// "c", "ca" and "caabl" have a single child and are not keys
+		want := []string{"", "a", "as", "ask", "at", "caa", "caab", "caable", "caal", "caalc", "caalcr", "caalcu", "caalm", "caat"}
+		assert.Equal(t, want, branchPoints(newFixtureTrie()))
+	})
+	t.Run("a single key is one branch point", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("caalcu", "ok")
+		assert.Equal(t, []string{"caalcu"}, branchPoints(trie))
+	})
+	t.Run("root as a key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("", "ok")
+		trie.Insert("abc", "ok")
+		assert.Equal(t, []string{"", "abc"}, branchPoints(trie))
+		assert.Equal(t, []string{}, branchPoints(NewTrie[string]()))
+	})
+}
+
+func TestTrieKeyNormalizer(t *testing.T) {
+	composed := "caf\u00e9"
+	decomposed := "cafe\u0301"
+
+	t.Run("both encodings resolve to the same key", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[string](norm.NFC.String))
+		assert.Equal(t, nil, trie.Insert(composed, "ok"))
+		assert.ErrorIs(t, trie.Insert(decomposed, "ok"), ErrAlreadyExists)
+
+		got, err := trie.Search(decomposed)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "ok", got)
+		assert.True(t, trie.Contains(decomposed))
+		assert.Equal(t, []string{composed}, trie.GetAll())
+
+		_, err = trie.Delete(decomposed)
+		assert.Equal(t, nil, err)
+		assert.True(t, trie.IsEmpty())
+	})
+	t.Run("prefixes are normalized too", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[int](strings.ToLower))
+		trie.Insert("Hello", 1)
+		trie.Insert("help", 2)
+		assert.Equal(t, []string{"hello", "help"}, trie.PrefixSearch("HEL"))
+		assert.Equal(t, []Entry[int]{{Key: "hello", Value: 1}}, trie.AutoComplete("HELLO"))
+		assert.Equal(t, []string{"hello"}, trie.PrefixesOf("HELLO world"))
+		n, ok := trie.BranchFactor("HEL")
+		assert.True(t, ok)
+		assert.Equal(t, 2, n)
+		entries, err := trie.PopPrefix("HELP")
+		assert.Nil(t, err)
+		assert.Equal(t, []Entry[int]{{Key: "help", Value: 2}}, entries)
+	})
+	t.Run("without normalization encodings are distinct keys", func(t *testing.T) {
+		trie := NewTrie[string]()
+		assert.Equal(t, nil, trie.Insert(composed, "ok"))
+		assert.Equal(t, nil, trie.Insert(decomposed, "ok"))
+		assert.Equal(t, 2, trie.Len())
+	})
+}
 
-	// str := trie.Visualize()
-	str := PrintTrie(trie.Root, "", 0, true)
-	t.Logf(str)
+func TestTrieShortestKey(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		_, ok := NewTrie[string]().ShortestKey()
+		assert.False(t, ok)
+	})
+	t.Run("shortest key is a prefix of longer ones", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("hello", "ok")
+		trie.Insert("help", "ok")
+		trie.Insert("hel", "ok")
+		trie.Insert("world", "ok")
+		got, ok := trie.ShortestKey()
+		assert.True(t, ok)
+		assert.Equal(t, "hel", got)
+	})
+	t.Run("ties are broken lexicographically", func(t *testing.T) {
+		trie := newFixtureTrie()
+		got, ok := trie.ShortestKey()
+		assert.True(t, ok)
+		assert.Equal(t, "as", got)
+
+		trie = NewTrie[string]()
+		trie.Insert("zz", "ok")
+		trie.Insert("abc", "ok")
+		trie.Insert("ab", "ok")
+		got, _ = trie.ShortestKey()
+		assert.Equal(t, "ab", got)
+	})
+}
+
+func TestTrieDump(t *testing.T) {
+	t.Run("sorted key value lines", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("hello", 2)
+		trie.Insert("world", 4)
+		trie.Insert("hel", 1)
+		trie.Insert("help", 3)
+
+		expected := "hel\t1\nhello\t2\nhelp\t3\nworld\t4\n"
+		assert.Equal(t, expected, trie.Dump())
+	})
+	t.Run("empty trie", func(t *testing.T) {
+		assert.Equal(t, "", NewTrie[int]().Dump())
+	})
+}
+
+func TestTrieChildrenSorted(t *testing.T) {
+	trie := NewTrie[string]()
+	for _, word := range []string{"zeta", "alpha", "mu", "beta", "alphabet", "omega"} {
+		trie.Insert(word, "ok")
+	}
+	trie.WalkNodes(func(path string, node *Node[string]) {
+		assert.True(t, slices.IsSortedFunc(node.Children, func(a, b *Node[string]) int {
+			return cmp.Compare(a.KeyRune, b.KeyRune)
+		}), "children of %q are not sorted", path)
+	})
+	assert.Equal(t, []string{"alpha", "alphabet", "beta", "mu", "omega", "zeta"}, trie.GetAll())
+}
+
+// linearChildIndex is the linear scan childIndex used before children were sorted
+func linearChildIndex[T any](node *Node[T], r rune) int {
+	for i := range node.Children {
+		if node.Children[i].KeyRune == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func BenchmarkChildLookup(b *testing.B) {
+	// nodes of growing fan-out, up to the width of a CJK text trie
+	for _, width := range []int{2, 8, 32, 128, 2000} {
+		node := &Node[int]{}
+		runes := []rune{}
+		index := map[rune]*Node[int]{}
+		for r := rune(0x4E00); r < 0x4E00+rune(width); r++ {
+			runes = append(runes, r)
+			child := &Node[int]{KeyRune: r}
+			node.Children = append(node.Children, child)
+			index[r] = child
+		}
+		rng := rand.New(rand.NewPCG(1, 2))
+		rng.Shuffle(len(runes), func(i, j int) { runes[i], runes[j] = runes[j], runes[i] })
+
+		b.Run(fmt.Sprintf("binary/%d", width), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				childIndex(node, runes[i%len(runes)])
+			}
+		})
+		b.Run(fmt.Sprintf("map/%d", width), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = index[runes[i%len(runes)]]
+			}
+		})
+		b.Run(fmt.Sprintf("linear/%d", width), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearChildIndex(node, runes[i%len(runes)])
+			}
+		})
+	}
+}
+
+func TestTrieIncrement(t *testing.T) {
+	add := func(a, b int) int { return a + b }
+
+	t.Run("count repeated words", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, word := range strings.Fields("the cat and the hat and the bat") {
+			_, err := trie.Increment(word, 1, add)
+			assert.Equal(t, nil, err)
+		}
+		assert.Equal(t, map[string]int{"the": 3, "and": 2, "cat": 1, "hat": 1, "bat": 1}, trie.ToMap())
+	})
+	t.Run("returns the new value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		got, _ := trie.Increment("a", 5, add)
+		assert.Equal(t, 5, got)
+		got, _ = trie.Increment("a", -2, add)
+		assert.Equal(t, 3, got)
+	})
+	t.Run("prefix of a key is created", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("hello", 10)
+		got, _ := trie.Increment("hel", 1, add)
+		assert.Equal(t, 1, got)
+		assert.Equal(t, map[string]int{"hel": 1, "hello": 10}, trie.ToMap())
+	})
+	t.Run("invalid key returns error", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxKeyLen[int](2))
+		_, err := trie.Increment("hello", 1, add)
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func TestTrieStream(t *testing.T) {
+	t.Run("drain every key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		got := []string{}
+		for key := range trie.Stream(context.Background()) {
+			got = append(got, key)
+		}
+		assert.Equal(t, trie.GetAll(), got)
+	})
+	t.Run("abandon early", func(t *testing.T) {
+		trie := newFixtureTrie()
+		ctx, cancel := context.WithCancel(context.Background())
+		keys := trie.Stream(ctx)
+		assert.Equal(t, "as", <-keys)
+		cancel()
+
+		// the producer must stop and close the channel rather than block forever
+		done := make(chan struct{})
+		go func() {
+			for range keys {
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stream was not closed after cancel")
+		}
+	})
+}
+
+func TestReducePrefix(t *testing.T) {
+	trie := NewTrie[int]()
+	trie.Insert("error", 1)
+	trie.Insert("error.io", 10)
+	trie.Insert("error.net", 5)
+	trie.Insert("error.net.dns", 2)
+	trie.Insert("warn", 100)
+
+	sum := func(acc int, key string, value int) int { return acc + value }
+	t.Run("sum values under a prefix", func(t *testing.T) {
+		assert.Equal(t, 17, ReducePrefix(trie, "error.", 0, sum))
+		assert.Equal(t, 18, ReducePrefix(trie, "error", 0, sum))
+		assert.Equal(t, 118, ReducePrefix(trie, "", 0, sum))
+	})
+	t.Run("absent prefix returns init", func(t *testing.T) {
+		assert.Equal(t, 42, ReducePrefix(trie, "info", 42, sum))
+	})
+	t.Run("accumulator type differs from value type", func(t *testing.T) {
+		keys := ReducePrefix(trie, "error.net", []string{}, func(acc []string, key string, value int) []string {
+			return append(acc, key)
+		})
+		assert.Equal(t, []string{"error.net", "error.net.dns"}, keys)
+	})
+}
+
+func TestTrieSearchPath(t *testing.T) {
+	trie := newFixtureTrie()
+
+	t.Run("path follows the key", func(t *testing.T) {
+		got, path, err := trie.SearchPath("caalc")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "ok", got)
+		assert.Equal(t, 5, len(path))
+		runes := []rune{}
+		for _, node := range path {
+			runes = append(runes, node.KeyRune)
+		}
+		assert.Equal(t, "caalc", string(runes))
+		assert.True(t, path[len(path)-1].IsEnd)
+		assert.False(t, path[len(path)-2].IsEnd)
+	})
+	t.Run("prefix-only and absent keys return error", func(t *testing.T) {
+		_, path, err := trie.SearchPath("caal")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Nil(t, path)
+		_, path, err = trie.SearchPath("caax")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Nil(t, path)
+	})
+}
+
+func TestTrieEmptyKey(t *testing.T) {
+	t.Run("empty key is stored on the root", func(t *testing.T) {
+		trie := NewTrie[string]()
+		assert.Equal(t, nil, trie.Insert("", "root"))
+		assert.ErrorIs(t, trie.Insert("", "root"), ErrAlreadyExists)
+		trie.Insert("a", "ok")
+
+		got, err := trie.Search("")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "root", got)
+		assert.True(t, trie.Contains(""))
+		assert.Equal(t, []string{"", "a"}, trie.GetAll())
+		assert.Equal(t, 2, trie.Len())
+		assert.Equal(t, map[string]string{"": "root", "a": "ok"}, trie.ToMap())
+		assert.Equal(t, "*\n└── a*\n", trie.Pretty())
+	})
+	t.Run("delete the empty key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("", "root")
+		trie.Insert("a", "ok")
+
+		got, err := trie.Delete("")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "root", got)
+		assert.Equal(t, []string{"a"}, trie.GetAll())
+		_, err = trie.Delete("")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 1, len(trie.Root.Children))
+	})
+	t.Run("empty key is a prefix of every key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("", "root")
+		trie.Insert("a", "ok")
+		assert.Equal(t, []string{"", "a"}, trie.PrefixSearch(""))
+		got, _ := trie.MinKey()
+		assert.Equal(t, "", got)
+		assert.False(t, trie.IsEmpty())
+	})
+	t.Run("search empty key that was never inserted", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("a", "ok")
+		_, err := trie.Search("")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.False(t, trie.Contains(""))
+	})
+}
+
+func TestTrieClassify(t *testing.T) {
+	trie := newFixtureTrie()
+	tests := []struct {
+		query    string
+		isKey    bool
+		isPrefix bool
+	}{
+		{query: "as", isKey: true, isPrefix: true},
+		{query: "at", isKey: true, isPrefix: false},
+		{query: "caal", isKey: false, isPrefix: true},
+		{query: "cat", isKey: false, isPrefix: false},
+	}
+	for _, test := range tests {
+		isKey, isPrefix := trie.Classify(test.query)
+		assert.Equal(t, test.isKey, isKey, test.query)
+		assert.Equal(t, test.isPrefix, isPrefix, test.query)
+	}
+}
+
+func TestTrieWideNode(t *testing.T) {
+	wide := []string{}
+	for r := rune(0x4E00); r < 0x4E00+childMapThreshold*2; r++ {
+		wide = append(wide, string(r))
+	}
+
+	t.Run("children are indexed past the threshold", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, key := range wide[:childMapThreshold-1] {
+			trie.Insert(key, i)
+		}
+		assert.Nil(t, trie.Root.childMap)
+
+		for i, key := range wide[childMapThreshold-1:] {
+			trie.Insert(key, childMapThreshold-1+i)
+		}
+		assert.Equal(t, len(wide), len(trie.Root.childMap))
+		for i, key := range wide {
+			got, err := trie.Search(key)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, i, got)
+		}
+		assert.Equal(t, wide, trie.GetAll())
+	})
+	t.Run("delete keeps the index in sync", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, key := range wide {
+			trie.Insert(key, i)
+		}
+		for _, key := range wide[:len(wide)-childMapThreshold/2] {
+			_, err := trie.Delete(key)
+			assert.Equal(t, nil, err)
+			_, err = trie.Search(key)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.False(t, trie.Contains(key))
+		}
+		// dropped once below half the threshold
+		trie.Delete(wide[len(wide)-childMapThreshold/2])
+		assert.Nil(t, trie.Root.childMap)
+		assert.Equal(t, wide[len(wide)-childMapThreshold/2+1:], trie.GetAll())
+	})
+	t.Run("bulk removal reindexes", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, key := range wide {
+			trie.Insert(key, i)
+		}
+		trie.DeleteIf(func(key string, value int) bool { return value%2 == 0 })
+		assert.Equal(t, len(wide)/2, len(trie.Root.childMap))
+		for i, key := range wide {
+			assert.Equal(t, i%2 == 1, trie.Contains(key))
+		}
+	})
+}
+
+func TestTrieOptimize(t *testing.T) {
+	t.Run("keys unchanged and capacity tightened after churn", func(t *testing.T) {
+		trie := NewTrie[int]()
+		words := benchmarkWords(2000)
+		for i, word := range words {
+			trie.Insert(word, i)
+		}
+		for _, word := range words[:1500] {
+			trie.Delete(word)
+		}
+		want := trie.GetAll()
+
+		trie.Optimize()
+		assert.Equal(t, want, trie.GetAll())
+		trie.WalkNodes(func(path string, node *Node[int]) {
+			assert.Equal(t, len(node.Children), cap(node.Children), path)
+		})
+		assert.Equal(t, len(trie.Root.Children), cap(trie.Root.Children))
+	})
+	t.Run("orphans removed and children sorted", func(t *testing.T) {
+		trie := newFixtureTrie()
+		// corrupt the trie with an orphan and out of order children
+		trie.Root.Children = append(trie.Root.Children, &Node[string]{KeyRune: 'z'})
+		trie.Root.Children[0], trie.Root.Children[1] = trie.Root.Children[1], trie.Root.Children[0]
+
+		trie.Optimize()
+		assert.Equal(t, 0, countOrphans(trie.Root))
+		assert.Equal(t, newFixtureTrie().GetAll(), trie.GetAll())
+		_, err := trie.Search("caalc")
+		assert.Equal(t, nil, err)
+	})
+}
+
+func TestTrieClone(t *testing.T) {
+	newSliceTrie := func() *Trie[[]int] {
+		trie := NewTrie[[]int]()
+		trie.Insert("a", []int{1, 2})
+		trie.Insert("ab", []int{3})
+		return trie
+	}
+	t.Run("keys are independent", func(t *testing.T) {
+		trie := newFixtureTrie()
+		clone := trie.Clone()
+		assert.Equal(t, trie.ToMap(), clone.ToMap())
+		assert.Equal(t, trie.NodeCount(), clone.NodeCount())
+
+		clone.Insert("new", "ok")
+		clone.Delete("caat")
+		clone.SetValue("as", "changed")
+		assert.Equal(t, newFixtureTrie().ToMap(), trie.ToMap())
+		assert.Nil(t, trie.Validate())
+		assert.Nil(t, clone.Validate())
+	})
+	t.Run("values share references without a cloner", func(t *testing.T) {
+		trie := newSliceTrie()
+		clone := trie.Clone()
+		value, _ := clone.Search("a")
+		value[0] = 10
+		got, _ := trie.Search("a")
+		assert.Equal(t, []int{10, 2}, got)
+	})
+	t.Run("deep cloner makes values independent", func(t *testing.T) {
+		trie := newSliceTrie()
+		clone := trie.CloneWith(slices.Clone[[]int])
+		assert.Equal(t, trie.ToMap(), clone.ToMap())
+		clone.Walk(func(key string, value []int) error {
+			value[0] = 10
+			return nil
+		})
+		assert.Equal(t, newSliceTrie().ToMap(), trie.ToMap())
+		assert.Equal(t, map[string][]int{"a": {10, 2}, "ab": {10}}, clone.ToMap())
+	})
+	t.Run("options carry over", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxKeyLen[int](2))
+		clone := trie.Clone()
+		assert.ErrorIs(t, clone.Insert("abc", 1), ErrKeyTooLong)
+	})
+}
+
+func TestTrieOptimizeInto(t *testing.T) {
+	t.Run("copy holds the same keys and the original is untouched", func(t *testing.T) {
+		trie := newFixtureTrie()
+		// leave a node with no key below it for the optimized copy to prune
+		node, _ := trie.NodeAt("caalcu")
+		node.IsEnd = false
+		want := trie.ToMap()
+		nodes := trie.NodeCount()
+
+		optimized := trie.OptimizeInto()
+		assert.Equal(t, want, optimized.ToMap())
+		assert.Less(t, optimized.NodeCount(), nodes)
+		assert.NotSame(t, trie.Root, optimized.Root)
+
+		assert.Equal(t, want, trie.ToMap())
+		assert.Equal(t, nodes, trie.NodeCount())
+		_, found := trie.NodeAt("caalcu")
+		assert.Equal(t, true, found)
+	})
+	t.Run("readers see a whole trie across the swap", func(t *testing.T) {
+		var current atomic.Pointer[Trie[string]]
+		current.Store(newFixtureTrie())
+		want := newFixtureTrie().ToMap()
+
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 100 {
+					assert.Equal(t, want, current.Load().ToMap())
+				}
+			}()
+		}
+		for range 10 {
+			current.Store(current.Load().OptimizeInto())
+		}
+		wg.Wait()
+		assert.Equal(t, want, current.Load().ToMap())
+	})
+}
+
+func TestTrieKeysByValue(t *testing.T) {
+	t.Run("keys sorted by value", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithValueCompare[int](cmp.Compare[int]))
+		trie.Insert("gold", 3)
+		trie.Insert("silver", 2)
+		trie.Insert("bronze", 1)
+		trie.Insert("wood", 10)
+		trie.Insert("", -1)
+		assert.Equal(t, []string{"", "bronze", "silver", "gold", "wood"}, trie.KeysByValue())
+	})
+	t.Run("descending comparison ranks highest first", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithValueCompare(func(a, b int) int { return cmp.Compare(b, a) }))
+		trie.Insert("a", 1)
+		trie.Insert("b", 7)
+		trie.Insert("c", 4)
+		assert.Equal(t, []string{"b", "c", "a"}, trie.KeysByValue())
+	})
+	t.Run("equal values in lexicographic order", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithValueCompare[int](cmp.Compare[int]))
+		trie.Insert("z", 1)
+		trie.Insert("b", 1)
+		trie.Insert("a", 0)
+		assert.Equal(t, []string{"a", "b", "z"}, trie.KeysByValue())
+	})
+	t.Run("no comparison falls back to lexicographic order", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, trie.GetAll(), trie.KeysByValue())
+	})
+}
+
+func TestTrieGetAllPrefixKeys(t *testing.T) {
+	sets := [][]string{
+		{"a", "ab", "abc"},
+		{"a", "ab", "abc", "abd", "ac"},
+		{"", "x", "xy", "xyz", "y"},
+	}
+	for _, words := range sets {
+		want := slices.Clone(words)
+		slices.Sort(want)
+		for _, order := range permutations(words) {
+			trie := NewTrie[int]()
+			for i, word := range order {
+				assert.Equal(t, nil, trie.Insert(word, i))
+			}
+			assert.Equal(t, want, trie.GetAll(), "insert order %q", order)
+			assert.Equal(t, len(want), trie.Len(), "insert order %q", order)
+
+			// deleting one key leaves the keys around it in place
+			last := want[len(want)-1]
+			trie.Delete(last)
+			assert.Equal(t, want[:len(want)-1], trie.GetAll(), "insert order %q", order)
+		}
+	}
+}
+
+func TestTrieWalkPrefix(t *testing.T) {
+	t.Run("visits only keys under prefix", func(t *testing.T) {
+		trie := newFixtureTrie()
+		got := []string{}
+		err := trie.WalkPrefix("caal", func(key string, value string) error {
+			got = append(got, key)
+			return nil
+		})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"caalc", "caalcr", "caalcu", "caalm"}, got)
+	})
+	t.Run("prefix which is a key is included", func(t *testing.T) {
+		trie := newFixtureTrie()
+		got := []string{}
+		trie.WalkPrefix("as", func(key string, value string) error {
+			got = append(got, key)
+			return nil
+		})
+		assert.Equal(t, []string{"as", "ask"}, got)
+	})
+	t.Run("error stops the walk", func(t *testing.T) {
+		trie := newFixtureTrie()
+		errStop := errors.New("stop")
+		got := []string{}
+		err := trie.WalkPrefix("caal", func(key string, value string) error {
+			got = append(got, key)
+			if key == "caalcr" {
+				return errStop
+			}
+			return nil
+		})
+		assert.Equal(t, errStop, err)
+		assert.Equal(t, []string{"caalc", "caalcr"}, got)
+	})
+	t.Run("absent prefix returns error", func(t *testing.T) {
+		trie := newFixtureTrie()
+		called := false
+		err := trie.WalkPrefix("caaz", func(key string, value string) error {
+			called = true
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.False(t, called)
+	})
+}
+
+func TestTrieZeroValue(t *testing.T) {
+	trie := NewTrie[int]()
+	trie.Insert("zero", 0)
+	trie.Insert("one", 1)
+
+	t.Run("stored zero value is present", func(t *testing.T) {
+		got, err := trie.Search("zero")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 0, got)
+		assert.True(t, trie.Contains("zero"))
+		isKey, _ := trie.Classify("zero")
+		assert.True(t, isKey)
+	})
+	t.Run("missing key is absent", func(t *testing.T) {
+		got, err := trie.Search("two")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 0, got)
+		assert.False(t, trie.Contains("two"))
+		// a prefix of a key holds the zero value but is not a key
+		_, err = trie.Search("zer")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("accessors include zero values", func(t *testing.T) {
+		assert.Equal(t, map[string]int{"zero": 0, "one": 1}, trie.ToMap())
+		assert.Equal(t, []string{"one", "zero"}, trie.GetAll())
+		assert.Equal(t, 2, trie.Len())
+		assert.Equal(t, []Entry[int]{{Key: "zero", Value: 0}}, trie.AutoComplete("z"))
+	})
+	t.Run("delete returns the zero value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("zero", 0)
+		got, err := trie.Delete("zero")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 0, got)
+		_, err = trie.Delete("zero")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestTrieDiff(t *testing.T) {
+	eq := func(a, b int) bool { return a == b }
+
+	t.Run("added removed and changed keys", func(t *testing.T) {
+		before, _ := NewTrieFromMap(map[string]int{"port": 80, "host": 1, "timeout": 30, "retries": 3})
+		after, _ := NewTrieFromMap(map[string]int{"port": 8080, "host": 1, "timeout": 60, "tls": 1, "debug": 0})
+
+		added, removed, changed := before.Diff(after, eq)
+		assert.Equal(t, []string{"debug", "tls"}, added)
+		assert.Equal(t, []string{"retries"}, removed)
+		assert.Equal(t, []string{"port", "timeout"}, changed)
+	})
+	t.Run("keys which prefix each other", func(t *testing.T) {
+		before, _ := NewTrieFromMap(map[string]int{"a": 1, "abc": 2})
+		after, _ := NewTrieFromMap(map[string]int{"ab": 1, "abc": 2})
+
+		added, removed, changed := before.Diff(after, eq)
+		assert.Equal(t, []string{"ab"}, added)
+		assert.Equal(t, []string{"a"}, removed)
+		assert.Equal(t, []string{}, changed)
+	})
+	t.Run("identical tries have no differences", func(t *testing.T) {
+		added, removed, changed := newFixtureTrie().Diff(newFixtureTrie(), func(a, b string) bool { return a == b })
+		assert.Equal(t, []string{}, added)
+		assert.Equal(t, []string{}, removed)
+		assert.Equal(t, []string{}, changed)
+	})
+}
+
+func TestTrieInsertOrGet(t *testing.T) {
+	t.Run("first insert stores value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		actual, loaded := trie.InsertOrGet("key", 1)
+		assert.Equal(t, 1, actual)
+		assert.False(t, loaded)
+		got, _ := trie.Search("key")
+		assert.Equal(t, 1, got)
+	})
+	t.Run("conflicting insert returns existing value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.InsertOrGet("key", 1)
+		actual, loaded := trie.InsertOrGet("key", 2)
+		assert.Equal(t, 1, actual)
+		assert.True(t, loaded)
+		got, _ := trie.Search("key")
+		assert.Equal(t, 1, got)
+	})
+	t.Run("prefix of existing key is inserted", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("keys", 1)
+		actual, loaded := trie.InsertOrGet("key", 2)
+		assert.Equal(t, 2, actual)
+		assert.False(t, loaded)
+		assert.Equal(t, []string{"key", "keys"}, trie.GetAll())
+	})
+	t.Run("rejected key is not stored", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxKeyLen[int](2))
+		actual, loaded := trie.InsertOrGet("key", 2)
+		assert.Equal(t, 0, actual)
+		assert.False(t, loaded)
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func TestTrieSetValue(t *testing.T) {
+	t.Run("updates present key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, nil, trie.SetValue("caalc", "new"))
+		got, _ := trie.Search("caalc")
+		assert.Equal(t, "new", got)
+		assert.Equal(t, newFixtureTrie().GetAll(), trie.GetAll())
+	})
+	t.Run("absent key is not created", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.ErrorIs(t, trie.SetValue("caal", "new"), ErrNotFound)
+		assert.ErrorIs(t, trie.SetValue("dog", "new"), ErrNotFound)
+		assert.False(t, trie.Contains("caal"))
+		assert.Equal(t, newFixtureTrie().GetAll(), trie.GetAll())
+	})
+}
+
+// failingWriter fails every write after the first n
+type failingWriter struct {
+	n      int
+	writes int
+}
+
+var errWrite = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > w.n {
+		return 0, errWrite
+	}
+	return len(p), nil
+}
+
+func TestTrieFprint(t *testing.T) {
+	t.Run("matches Pretty", func(t *testing.T) {
+		trie := newFixtureTrie()
+		var buf bytes.Buffer
+		assert.Equal(t, nil, trie.Fprint(&buf))
+		assert.Equal(t, trie.Pretty(), buf.String())
+
+		expected, err := os.ReadFile(filepath.Join("testdata", "visualize.golden"))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, string(expected), buf.String())
+	})
+	t.Run("writer error stops rendering", func(t *testing.T) {
+		trie := newFixtureTrie()
+		w := &failingWriter{n: 3}
+		assert.Equal(t, errWrite, trie.Fprint(w))
+		assert.Equal(t, 4, w.writes)
+	})
+}
+
+func TestTrieSubTrie(t *testing.T) {
+	t.Run("prefix stripped", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("apple", 1)
+		trie.Insert("apply", 2)
+		trie.Insert("banana", 3)
+
+		sub, err := trie.SubTrie("appl", false)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, map[string]int{"e": 1, "y": 2}, sub.ToMap())
+	})
+	t.Run("prefix kept", func(t *testing.T) {
+		trie := newFixtureTrie()
+		sub, err := trie.SubTrie("caal", true)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"caalc", "caalcr", "caalcu", "caalm"}, sub.GetAll())
+		assert.Equal(t, 0, countOrphans(sub.Root))
+	})
+	t.Run("prefix which is a key becomes the empty key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		sub, err := trie.SubTrie("as", false)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"", "k"}, sub.GetAll())
+	})
+	t.Run("prefix stripped from stored keys of soft deleted keys", func(t *testing.T) {
+		trie := NewTrieStoringKeys[int]()
+		trie.Insert("abc", 1)
+		trie.Insert("abd", 2)
+		assert.Nil(t, trie.SoftDelete("abc"))
+		sub, err := trie.SubTrie("ab", false)
+		assert.Nil(t, err)
+		assert.Nil(t, sub.Undelete("c"))
+		assert.Equal(t, []string{"c", "d"}, sub.GetAll())
+	})
+	t.Run("independent of the source", func(t *testing.T) {
+		trie := newFixtureTrie()
+		sub, _ := trie.SubTrie("caa", true)
+		sub.Insert("caaz", "new")
+		sub.Delete("caalc")
+		sub.SetValue("caat", "changed")
+
+		assert.Equal(t, newFixtureTrie().GetAll(), trie.GetAll())
+		got, _ := trie.Search("caat")
+		want, _ := newFixtureTrie().Search("caat")
+		assert.Equal(t, want, got)
+	})
+	t.Run("absent prefix returns error", func(t *testing.T) {
+		sub, err := newFixtureTrie().SubTrie("dog", false)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Nil(t, sub)
+	})
+}
+
+func BenchmarkTraversalLogging(b *testing.B) {
+	trie := NewTrie[int]()
+	for i, word := range benchmarkWords(10000) {
+		trie.Insert(word, i)
+	}
+
+	b.Run("without logging", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie.GetAll()
+		}
+	})
+	// the per-node debug log traversals used to do, which costs time even when the level discards it
+	b.Run("with per-node debug log", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie.WalkNodes(func(path string, node *Node[int]) {
+				slog.Debug("node", "val", node)
+			})
+			trie.GetAll()
+		}
+	})
+}
+
+func TestTrieMapValues(t *testing.T) {
+	t.Run("every value transformed", func(t *testing.T) {
+		trie, _ := NewTrieFromMap(map[string]int{"": 1, "a": 2, "ab": 3, "b": 4})
+		trie.MapValues(func(key string, old int) int { return old * 2 })
+		assert.Equal(t, map[string]int{"": 2, "a": 4, "ab": 6, "b": 8}, trie.ToMap())
+	})
+	t.Run("fn is given each key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		trie.MapValues(func(key string, old string) string { return strings.ToUpper(key) })
+		assert.Equal(t, newFixtureTrie().GetAll(), trie.GetAll())
+		for _, key := range trie.GetAll() {
+			got, _ := trie.Search(key)
+			assert.Equal(t, strings.ToUpper(key), got)
+		}
+	})
+}
+
+func TestTrieCompressionPotential(t *testing.T) {
+	t.Run("single long key is one chain", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("caalcu", 0)
+		chains, total := trie.CompressionPotential()
+		assert.Equal(t, 5, chains)
+		assert.Equal(t, 6, total)
+	})
+	t.Run("fixture", func(t *testing.T) {
+		// c-a and the l below caab are chain nodes, end nodes such as caab are not
+		chains, total := newFixtureTrie().CompressionPotential()
+		assert.Equal(t, 3, chains)
+		assert.Equal(t, 16, total)
+		assert.Equal(t, newFixtureTrie().Stats().Nodes, total)
+	})
+	t.Run("empty trie", func(t *testing.T) {
+		chains, total := NewTrie[int]().CompressionPotential()
+		assert.Equal(t, 0, chains)
+		assert.Equal(t, 0, total)
+	})
+}
+
+func TestTrieCompareAndSwap(t *testing.T) {
+	eq := func(a, b int) bool { return a == b }
+
+	t.Run("swaps matching value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("key", 1)
+		assert.True(t, trie.CompareAndSwap("key", 1, 2, eq))
+		got, _ := trie.Search("key")
+		assert.Equal(t, 2, got)
+	})
+	t.Run("mismatch leaves value", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("key", 1)
+		assert.False(t, trie.CompareAndSwap("key", 5, 2, eq))
+		got, _ := trie.Search("key")
+		assert.Equal(t, 1, got)
+	})
+	t.Run("absent key is not created", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("keys", 0)
+		assert.False(t, trie.CompareAndSwap("key", 0, 2, eq))
+		assert.False(t, trie.CompareAndSwap("dog", 0, 2, eq))
+		assert.Equal(t, []string{"keys"}, trie.GetAll())
+	})
+}
+
+func TestTrieKeysWithValue(t *testing.T) {
+	type route struct {
+		handler    string
+		deprecated bool
+	}
+	trie := NewTrie[route]()
+	trie.Insert("/v1/users", route{"users", true})
+	trie.Insert("/v1/users/list", route{"list", true})
+	trie.Insert("/v2/users", route{"users", false})
+	trie.Insert("/v2/users/list", route{"list", false})
+	trie.Insert("/health", route{"health", false})
+
+	deprecated := func(r route) bool { return r.deprecated }
+	assert.Equal(t, []string{"/v1/users", "/v1/users/list"}, trie.KeysWithValue(deprecated))
+	assert.Equal(t, []string{}, trie.KeysWithValue(func(r route) bool { return r.handler == "missing" }))
+	assert.Equal(t, trie.GetAll(), trie.KeysWithValue(func(route) bool { return true }))
+	assert.Equal(t, 5, trie.Len())
+}
+
+func TestTrieKeysUpToDepth(t *testing.T) {
+	t.Run("deeper keys excluded", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, []string{}, trie.KeysUpToDepth(1))
+		assert.Equal(t, []string{"as", "at"}, trie.KeysUpToDepth(2))
+		assert.Equal(t, []string{"as", "ask", "at"}, trie.KeysUpToDepth(3))
+		assert.Equal(t, []string{"as", "ask", "at", "caab", "caat"}, trie.KeysUpToDepth(4))
+		assert.Equal(t, trie.GetAll(), trie.KeysUpToDepth(6))
+	})
+	t.Run("empty key is at depth zero", func(t *testing.T) {
+		trie := newFixtureTrie()
+		trie.Insert("", "")
+		assert.Equal(t, []string{""}, trie.KeysUpToDepth(0))
+		assert.Equal(t, []string{}, trie.KeysUpToDepth(-1))
+	})
+	t.Run("traversal stops at max depth", func(t *testing.T) {
+		trie := newFixtureTrie()
+		node, _ := trie.NodeAt("as")
+		poisonChildren(node)
+		assert.NotPanics(t, func() {
+			assert.Equal(t, []string{"as", "at"}, trie.KeysUpToDepth(2))
+		})
+	})
+}
+
+func TestTrieDeleteAndCheck(t *testing.T) {
+	t.Run("empty only after the last key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		keys := trie.GetAll()
+		for i, key := range keys {
+			want, _ := trie.Search(key)
+			got, empty, err := trie.DeleteAndCheck(key)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, want, got)
+			assert.Equal(t, i == len(keys)-1, empty, key)
+		}
+		assert.True(t, trie.IsEmpty())
+	})
+	t.Run("empty key counts as a key", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("", 0)
+		trie.Insert("a", 1)
+		_, empty, _ := trie.DeleteAndCheck("a")
+		assert.False(t, empty)
+		_, empty, _ = trie.DeleteAndCheck("")
+		assert.True(t, empty)
+	})
+	t.Run("soft deleted keys don't count", func(t *testing.T) {
+		trie := newTrieOfKeys("ab", "abc")
+		assert.Nil(t, trie.SoftDelete("abc"))
+		_, empty, err := trie.DeleteAndCheck("ab")
+		assert.Nil(t, err)
+		assert.True(t, empty)
+	})
+	t.Run("absent key returns error", func(t *testing.T) {
+		trie := newFixtureTrie()
+		_, empty, err := trie.DeleteAndCheck("caal")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.False(t, empty)
+	})
+}
+
+func TestTrieGetOrDefault(t *testing.T) {
+	trie := NewTrie[int]()
+	trie.Insert("port", 8080)
+	trie.Insert("retries", 0)
+
+	assert.Equal(t, 8080, trie.GetOrDefault("port", 80))
+	assert.Equal(t, 0, trie.GetOrDefault("retries", 3))
+	assert.Equal(t, 30, trie.GetOrDefault("timeout", 30))
+	assert.Equal(t, 80, trie.GetOrDefault("por", 80))
+}
+
+func TestTrieDepthHistogram(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		// c a | ca as at | caa ask | caat caal caab | caalm caalc caabl | caalcu caalcr caable
+		assert.Equal(t, []int{1, 2, 3, 2, 3, 3, 3}, newFixtureTrie().DepthHistogram())
+	})
+	t.Run("counts add up to every node", func(t *testing.T) {
+		trie := newFixtureTrie()
+		total := 0
+		for _, count := range trie.DepthHistogram() {
+			total += count
+		}
+		assert.Equal(t, trie.Stats().Nodes+1, total)
+	})
+	t.Run("empty trie has only the root", func(t *testing.T) {
+		assert.Equal(t, []int{1}, NewTrie[int]().DepthHistogram())
+	})
+}
+
+func TestBreadthFirstSearch(t *testing.T) {
+	type visit struct {
+		key   string
+		depth int
+	}
+	record := func(node *Node[string], level int, key string, visits []visit) ([]visit, error) {
+		return append(visits, visit{key, level}), nil
+	}
+
+	t.Run("key and depth of every node", func(t *testing.T) {
+		trie := newFixtureTrie()
+		visits, err := breadthFirstSearch([]*Node[string]{trie.Root}, []rune{}, record, []visit{})
+		assert.Nil(t, err)
+		assert.Equal(t, []visit{
+			{"", 0},
+			{"a", 1}, {"c", 1},
+			{"as", 2}, {"at", 2}, {"ca", 2},
+			{"ask", 3}, {"caa", 3},
+			{"caab", 4}, {"caal", 4}, {"caat", 4},
+			{"caabl", 5}, {"caalc", 5}, {"caalm", 5},
+			{"caable", 6}, {"caalcr", 6}, {"caalcu", 6},
+		}, visits)
+		for _, v := range visits {
+			assert.Equal(t, utf8.RuneCountInString(v.key), v.depth, v.key)
+		}
+	})
+	t.Run("starting below the root", func(t *testing.T) {
+		node, _ := newFixtureTrie().NodeAt("caal")
+		visits, _ := breadthFirstSearch([]*Node[string]{node}, []rune("caal"), record, []visit{})
+		assert.Equal(t, []visit{{"caal", 0}, {"caalc", 1}, {"caalm", 1}, {"caalcr", 2}, {"caalcu", 2}}, visits)
+	})
+	t.Run("stops at the first error", func(t *testing.T) {
+		trie := newFixtureTrie()
+		stop := errors.New("stop")
+		visits, err := breadthFirstSearch([]*Node[string]{trie.Root}, []rune{}, func(node *Node[string], level int, key string, visits []visit) ([]visit, error) {
+			if level == 2 {
+				return visits, stop
+			}
+			return append(visits, visit{key, level}), nil
+		}, []visit{})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, []visit{{"", 0}, {"a", 1}, {"c", 1}}, visits)
+	})
+}
+
+func TestTrieInsertFunc(t *testing.T) {
+	calls := 0
+	factory := func() []int {
+		calls++
+		return make([]int, 0, 64)
+	}
+	trie := NewTrie[[]int]()
+
+	got, err := trie.InsertFunc("key", factory)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 64, cap(got))
+	assert.Equal(t, 1, calls)
+	assert.True(t, trie.Contains("key"))
+
+	got, err = trie.InsertFunc("key", factory)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Nil(t, got)
+	assert.Equal(t, 1, calls)
+
+	_, err = trie.InsertFunc("ke", factory)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestTrieStrictDisjoint(t *testing.T) {
+	newRoutes := func() *Trie[int] {
+		trie := NewTrieWithOptions(WithStrictDisjoint[int]())
+		assert.Nil(t, trie.Insert("/api/v1", 1))
+		assert.Nil(t, trie.Insert("/api/v2", 2))
+		assert.Nil(t, trie.Insert("/home", 3))
+		return trie
+	}
+
+	t.Run("new key is a prefix of an existing key", func(t *testing.T) {
+		trie := newRoutes()
+		nodes := trie.NodeCount()
+		err := trie.Insert("/api", 0)
+		assert.ErrorIs(t, err, ErrPrefixConflict)
+		assert.Contains(t, err.Error(), `"/api/v1"`)
+		assert.ErrorIs(t, trie.Insert("", 0), ErrPrefixConflict)
+		assert.Equal(t, nodes, trie.NodeCount())
+	})
+	t.Run("existing key is a prefix of the new key", func(t *testing.T) {
+		trie := newRoutes()
+		nodes := trie.NodeCount()
+		err := trie.InsertRunes([]rune("/home/user"), 0)
+		assert.ErrorIs(t, err, ErrPrefixConflict)
+		assert.Equal(t, `key is a prefix of or prefixed by the existing key "/home": "/home/user"`, err.Error())
+		assert.Equal(t, nodes, trie.NodeCount())
+		assert.Equal(t, []string{"/api/v1", "/api/v2", "/home"}, trie.GetAll())
+	})
+	t.Run("disjoint keys insert", func(t *testing.T) {
+		trie := newRoutes()
+		assert.Nil(t, trie.Insert("/api/v3", 4))
+		// sharing a prefix is fine, as long as neither is a key
+		assert.Nil(t, trie.Insert("/help", 5))
+		assert.Nil(t, trie.Insert("/api/w", 6))
+		assert.ErrorIs(t, trie.Insert("/api/v1", 0), ErrAlreadyExists)
+	})
+	t.Run("rename", func(t *testing.T) {
+		trie := newRoutes()
+		assert.ErrorIs(t, trie.Rename("/api/v1", "/api/v2/x"), ErrPrefixConflict)
+		// the key being moved doesn't conflict with its new name
+		assert.Nil(t, trie.Rename("/home", "/home/index"))
+		assert.Equal(t, []string{"/api/v1", "/api/v2", "/home/index"}, trie.GetAll())
+	})
+	t.Run("undelete", func(t *testing.T) {
+		trie := newRoutes()
+		assert.Nil(t, trie.SoftDelete("/home"))
+		assert.Nil(t, trie.Insert("/home/index", 4))
+		assert.ErrorIs(t, trie.Undelete("/home"), ErrPrefixConflict)
+		assert.Equal(t, []string{"/api/v1", "/api/v2", "/home/index"}, trie.GetAll())
+
+		assert.Nil(t, trie.SoftDelete("/api/v1"))
+		assert.Nil(t, trie.Undelete("/api/v1"))
+	})
+	t.Run("dry run", func(t *testing.T) {
+		trie := newRoutes()
+		added, duplicates := trie.DryRunInsert([]string{"/api", "/home/user", "/help", "/help/faq", "/home", "/api/v3"})
+		assert.Equal(t, []string{"/help", "/api/v3"}, added)
+		assert.Equal(t, []string{"/home"}, duplicates)
+	})
+	t.Run("off by default", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("/api/v1", 1)
+		assert.Nil(t, trie.Insert("/api", 0))
+	})
+}
+
+func TestTrieAllowedRunes(t *testing.T) {
+	lowerASCII := func(r rune) bool { return r >= 'a' && r <= 'z' }
+
+	t.Run("allowed keys insert", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithAllowedRunes[int](lowerASCII))
+		assert.Equal(t, nil, trie.Insert("hello", 1))
+		assert.Equal(t, nil, trie.Insert("", 0))
+		assert.Equal(t, []string{"", "hello"}, trie.GetAll())
+	})
+	t.Run("disallowed keys rejected without partial insertion", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithAllowedRunes[int](lowerASCII))
+		trie.Insert("hello", 1)
+		for _, key := range []string{"helLo", "help!", "héllo", "world1"} {
+			assert.ErrorIs(t, trie.Insert(key, 2), ErrInvalidRune, key)
+		}
+		assert.Equal(t, []string{"hello"}, trie.GetAll())
+		assert.Equal(t, 5, trie.Stats().Nodes)
+	})
+	t.Run("lookups of disallowed keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithAllowedRunes[int](lowerASCII))
+		trie.Insert("hello", 1)
+		_, err := trie.Search("HELLO")
+		assert.ErrorIs(t, err, ErrInvalidRune)
+		assert.False(t, trie.Contains("HELLO"))
+	})
+	t.Run("checked after normalization", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[int](strings.ToLower), WithAllowedRunes[int](lowerASCII))
+		assert.Equal(t, nil, trie.Insert("Hello", 1))
+		assert.Equal(t, []string{"hello"}, trie.GetAll())
+	})
+	t.Run("NUL rune rejected without options", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("ab", 1)
+		// both the ASCII and the rune paths must reject it
+		for _, key := range []string{"a\x00b", "\x00", "ab\x00", "é\x00"} {
+			assert.ErrorIs(t, trie.Insert(key, 2), ErrInvalidRune, key)
+			_, err := trie.Search(key)
+			assert.ErrorIs(t, err, ErrInvalidRune, key)
+			_, err = trie.Delete(key)
+			assert.ErrorIs(t, err, ErrInvalidRune, key)
+		}
+		assert.Equal(t, []string{"ab"}, trie.GetAll())
+		assert.Equal(t, 2, trie.NodeCount())
+		assert.Nil(t, trie.Validate())
+	})
+}
+
+func TestTriePrefixesOf(t *testing.T) {
+	t.Run("overlapping stored prefixes", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, word := range []string{"un", "unhappy", "unhappiness", "happy", "u", "unh"} {
+			trie.Insert(word, 0)
+		}
+		assert.Equal(t, []string{"u", "un", "unh", "unhappiness"}, trie.PrefixesOf("unhappiness"))
+		assert.Equal(t, []string{"u", "un", "unh", "unhappy"}, trie.PrefixesOf("unhappyness"))
+		assert.Equal(t, []string{"u", "un"}, trie.PrefixesOf("undo"))
+	})
+	t.Run("no stored prefixes", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, []string{}, trie.PrefixesOf("dog"))
+		assert.Equal(t, []string{}, trie.PrefixesOf("caa"))
+		assert.Equal(t, []string{}, trie.PrefixesOf(""))
+	})
+	t.Run("multi-byte runes and the empty key", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("", 0)
+		trie.Insert("日", 1)
+		trie.Insert("日本", 2)
+		assert.Equal(t, []string{"", "日", "日本"}, trie.PrefixesOf("日本語"))
+	})
+}
+
+func TestTriePrefixSearchPage(t *testing.T) {
+	t.Run("pages cover every key without gaps or duplicates", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, word := range benchmarkWords(500) {
+			trie.Insert(word, i)
+		}
+		trie.Insert("", 0)
+		for _, prefix := range []string{"", "a", "b"} {
+			want := trie.PrefixSearch(prefix)
+			for _, pageSize := range []int{2, 7, 50} {
+				got := []string{}
+				after := ""
+				for {
+					keys, next, err := trie.PrefixSearchPage(prefix, pageSize, after)
+					assert.Equal(t, nil, err)
+					assert.LessOrEqual(t, len(keys), pageSize)
+					got = append(got, keys...)
+					if next == "" {
+						break
+					}
+					after = next
+				}
+				assert.Equal(t, want, got, "prefix %q page size %d", prefix, pageSize)
+			}
+		}
+	})
+	t.Run("last page has no next token", func(t *testing.T) {
+		trie := newFixtureTrie()
+		keys, next, err := trie.PrefixSearchPage("caal", 2, "")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"caalc", "caalcr"}, keys)
+		assert.Equal(t, "caalcr", next)
+
+		keys, next, _ = trie.PrefixSearchPage("caal", 2, next)
+		assert.Equal(t, []string{"caalcu", "caalm"}, keys)
+		assert.Equal(t, "", next)
+	})
+	t.Run("after need not be a key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		keys, _, _ := trie.PrefixSearchPage("caa", 3, "caalcs")
+		assert.Equal(t, []string{"caalcu", "caalm", "caat"}, keys)
+	})
+	t.Run("absent prefix returns error", func(t *testing.T) {
+		keys, next, err := newFixtureTrie().PrefixSearchPage("dog", 2, "")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, []string{}, keys)
+		assert.Equal(t, "", next)
+	})
+}
+
+func TestTrieKeyError(t *testing.T) {
+	t.Run("insert conflict carries the key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		err := trie.Insert("caat", "again")
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		var keyErr *KeyError
+		assert.True(t, errors.As(err, &keyErr))
+		assert.Equal(t, "caat", keyErr.Key)
+		assert.Equal(t, `val already exists in trie: "caat"`, err.Error())
+	})
+	t.Run("search and delete carry the key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		_, err := trie.Search("caal")
+		var keyErr *KeyError
+		assert.True(t, errors.As(err, &keyErr))
+		assert.Equal(t, "caal", keyErr.Key)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = trie.Delete("dog")
+		assert.True(t, errors.As(err, &keyErr))
+		assert.Equal(t, "dog", keyErr.Key)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("key is the one passed in, before normalization", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[int](strings.ToLower), WithMaxKeyLen[int](3))
+		trie.Insert("abc", 1)
+		err := trie.Insert("ABC", 2)
+		var keyErr *KeyError
+		assert.True(t, errors.As(err, &keyErr))
+		assert.Equal(t, "ABC", keyErr.Key)
+
+		err = trie.Insert("ABCD", 2)
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+		assert.True(t, errors.As(err, &keyErr))
+		assert.Equal(t, "ABCD", keyErr.Key)
+	})
+	t.Run("successful operations return nil", func(t *testing.T) {
+		trie := NewTrie[int]()
+		assert.Nil(t, trie.Insert("a", 1))
+		_, err := trie.Delete("a")
+		assert.Nil(t, err)
+	})
+}
+
+func TestTrieNodeCount(t *testing.T) {
+	t.Run("overlapping keys share nodes", func(t *testing.T) {
+		assert.Equal(t, 16, newFixtureTrie().NodeCount())
+
+		trie := NewTrie[int]()
+		trie.Insert("a", 0)
+		trie.Insert("ab", 0)
+		trie.Insert("abc", 0)
+		assert.Equal(t, 3, trie.NodeCount())
+		trie.Insert("abd", 0)
+		assert.Equal(t, 4, trie.NodeCount())
+	})
+	t.Run("empty trie and empty key have no nodes", func(t *testing.T) {
+		trie := NewTrie[int]()
+		assert.Equal(t, 0, trie.NodeCount())
+		trie.Insert("", 0)
+		assert.Equal(t, 0, trie.NodeCount())
+	})
+	t.Run("delete removes nodes", func(t *testing.T) {
+		trie := newFixtureTrie()
+		trie.Delete("caable")
+		assert.Equal(t, 14, trie.NodeCount())
+		assert.Equal(t, trie.Stats().Nodes, trie.NodeCount())
+	})
+}
+
+func TestTrieMaintainedCounts(t *testing.T) {
+	// assertCounts checks the counts kept by the trie against a full traversal
+	assertCounts := func(t *testing.T, trie *Trie[int], step string) {
+		t.Helper()
+		assert.Equal(t, keyCount(trie.Root), trie.Len(), step)
+		assert.Equal(t, nodeCount(trie.Root)-1, trie.NodeCount(), step)
+	}
+	eq := func(a, b int) bool { return a == b }
+
+	trie := NewTrie[int]()
+	steps := []struct {
+		name string
+		fn   func()
+	}{
+		{"insert", func() {
+			for i, word := range benchmarkWords(200) {
+				trie.Insert(word, i)
+			}
+			trie.Insert("", 0)
+			trie.InsertRunes([]rune("héllo"), 1)
+		}},
+		{"duplicate insert", func() { trie.Insert("héllo", 2) }},
+		{"increment", func() { trie.Increment("counter", 1, func(a, b int) int { return a + b }) }},
+		{"delete", func() {
+			trie.Delete("héllo")
+			trie.DeleteRunes([]rune("counter"))
+			trie.Delete("missing")
+		}},
+		{"delete and count", func() {
+			trie.DeleteAndCount(trie.GetAll()[5])
+			trie.DeleteAndCheck(trie.GetAll()[7])
+		}},
+		{"delete all", func() { trie.DeleteAll(trie.GetAll()[10:20]) }},
+		{"delete if", func() { trie.DeleteIf(func(key string, value int) bool { return value%3 == 0 }) }},
+		{"soft delete", func() { trie.SoftDelete(trie.GetAll()[3]) }},
+		{"undelete", func() {
+			key := trie.GetAll()[4]
+			trie.SoftDelete(key)
+			trie.Undelete(key)
+		}},
+		{"rename", func() { trie.Rename(trie.GetAll()[1], "renamed") }},
+		{"pop prefix", func() { trie.PopPrefix(trie.GetAll()[2][:2]) }},
+		{"trim", func() { trie.TrimToSize(80, func(key string, value int) int { return value }) }},
+		{"sync", func() {
+			desired := trie.ToMap()
+			delete(desired, trie.GetAll()[0])
+			desired["synced"] = 1
+			trie.Sync(desired, eq)
+		}},
+		{"optimize", func() { trie.Optimize() }},
+		{"clear", func() { trie.Clear() }},
+		{"insert after clear", func() { trie.Insert("again", 1) }},
+	}
+	for _, step := range steps {
+		step.fn()
+		assertCounts(t, trie, step.name)
+	}
+
+	t.Run("copies", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, word := range benchmarkWords(50) {
+			trie.Insert(word, i)
+		}
+		trie.Insert("", 0)
+		assertCounts(t, trie.Clone(), "clone")
+		sub, _ := trie.SubTrie(trie.GetAll()[1][:1], false)
+		assertCounts(t, sub, "sub trie")
+		sub, _ = trie.SubTrie(trie.GetAll()[1][:1], true)
+		assertCounts(t, sub, "sub trie keeping the prefix")
+		for _, partition := range trie.Partitions() {
+			assertCounts(t, partition.Sub, "partition "+partition.Prefix)
+		}
+		flat, err := trie.Flatten()
+		assert.Nil(t, err)
+		inflated, err := InflateTrie(flat)
+		assert.Nil(t, err)
+		assertCounts(t, inflated, "inflate")
+
+		builder := NewTrieBuilder[int]()
+		for i, key := range trie.GetAll() {
+			builder.Add(key, i)
+		}
+		assertCounts(t, builder.Build(), "builder")
+	})
+	t.Run("nodes modified directly", func(t *testing.T) {
+		trie := newFixtureTrie()
+		node, _ := trie.NodeAt("caalcu")
+		node.IsEnd = false
+		trie.Prune()
+		assert.Equal(t, keyCount(trie.Root), trie.Len())
+		assert.Equal(t, nodeCount(trie.Root)-1, trie.NodeCount())
+	})
+}
+
+func TestTrieComplete(t *testing.T) {
+	t.Run("prefix is a key", func(t *testing.T) {
+		trie, _ := NewTrieFromMap(map[string]int{"go": 1, "gopher": 2, "golang": 3, "goto": 4, "git": 5})
+		exact, suggestions := trie.Complete("go", 2)
+		assert.NotNil(t, exact)
+		assert.Equal(t, 1, *exact)
+		assert.Equal(t, []Entry[int]{{Key: "golang", Value: 3}, {Key: "gopher", Value: 2}}, suggestions)
+
+		// exact is a copy, so it can't change the trie
+		*exact = 10
+		got, _ := trie.Search("go")
+		assert.Equal(t, 1, got)
+	})
+	t.Run("prefix is only a prefix", func(t *testing.T) {
+		trie := newFixtureTrie()
+		exact, suggestions := trie.Complete("caal", 10)
+		assert.Nil(t, exact)
+		keys := []string{}
+		for _, entry := range suggestions {
+			keys = append(keys, entry.Key)
+		}
+		assert.Equal(t, []string{"caalc", "caalcr", "caalcu", "caalm"}, keys)
+	})
+	t.Run("absent prefix and zero limit", func(t *testing.T) {
+		trie := newFixtureTrie()
+		exact, suggestions := trie.Complete("dog", 5)
+		assert.Nil(t, exact)
+		assert.Equal(t, []Entry[string]{}, suggestions)
+
+		exact, suggestions = trie.Complete("as", 0)
+		assert.NotNil(t, exact)
+		assert.Equal(t, []Entry[string]{}, suggestions)
+	})
+}
+
+func TestTrieRename(t *testing.T) {
+	t.Run("value moves to the new key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		want, _ := trie.Search("caalc")
+		seq, _ := trie.Sequence("caalc")
+
+		assert.Nil(t, trie.Rename("caalc", "dog"))
+		got, err := trie.Search("dog")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+		assert.False(t, trie.Contains("caalc"))
+		assert.True(t, trie.Contains("caalcu"))
+		newSeq, _ := trie.Sequence("dog")
+		assert.Equal(t, seq, newSeq)
+		assert.Equal(t, newFixtureTrie().Len(), trie.Len())
+	})
+	t.Run("rename to a prefix or extension of the old key", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("abc", 1)
+		assert.Nil(t, trie.Rename("abc", "a"))
+		assert.Equal(t, map[string]int{"a": 1}, trie.ToMap())
+		assert.Nil(t, trie.Rename("a", "abcd"))
+		assert.Equal(t, map[string]int{"abcd": 1}, trie.ToMap())
+		assert.Equal(t, 0, countOrphans(trie.Root))
+	})
+	t.Run("conflicting new key leaves the trie unchanged", func(t *testing.T) {
+		trie := newFixtureTrie()
+		before := trie.ToMap()
+		assert.ErrorIs(t, trie.Rename("caalc", "caat"), ErrAlreadyExists)
+		assert.ErrorIs(t, trie.Rename("caalc", "caalc"), ErrAlreadyExists)
+		assert.Equal(t, before, trie.ToMap())
+	})
+	t.Run("absent old key returns error", func(t *testing.T) {
+		trie := newFixtureTrie()
+		err := trie.Rename("caal", "dog")
+		assert.ErrorIs(t, err, ErrNotFound)
+		var keyErr *KeyError
+		assert.True(t, errors.As(err, &keyErr))
+		assert.Equal(t, "caal", keyErr.Key)
+		assert.False(t, trie.Contains("dog"))
+		assert.Equal(t, 0, countOrphans(trie.Root))
+	})
+}
+
+func TestTrieSync(t *testing.T) {
+	eq := func(a, b int) bool { return a == b }
+	t.Run("reconciles to the desired keys", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, key := range []string{"ant", "bee", "cat", "cow", "dog"} {
+			trie.Insert(key, i)
+		}
+		desired := map[string]int{"ant": 0, "bee": 10, "cow": 3, "crow": 5, "eel": 6, "": 7}
+		added, removed, updated := trie.Sync(desired, eq)
+		assert.Equal(t, 3, added)
+		assert.Equal(t, 2, removed)
+		assert.Equal(t, 1, updated)
+		assert.Equal(t, desired, trie.ToMap())
+		assert.Equal(t, []string{"", "ant", "bee", "cow", "crow", "eel"}, trie.GetAll())
+		assert.Equal(t, nodeCount(trie.Root)-1, trie.NodeCount())
+		assert.Nil(t, trie.Validate())
+
+		// syncing again changes nothing
+		added, removed, updated = trie.Sync(desired, eq)
+		assert.Equal(t, []int{0, 0, 0}, []int{added, removed, updated})
+	})
+	t.Run("to empty and back", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("a", 1)
+		trie.Insert("ab", 2)
+		added, removed, updated := trie.Sync(map[string]int{}, eq)
+		assert.Equal(t, []int{0, 2, 0}, []int{added, removed, updated})
+		assert.Equal(t, 0, trie.NodeCount())
+
+		added, removed, updated = trie.Sync(map[string]int{"a": 1, "ab": 2}, eq)
+		assert.Equal(t, []int{2, 0, 0}, []int{added, removed, updated})
+		assert.Equal(t, map[string]int{"a": 1, "ab": 2}, trie.ToMap())
+	})
+	t.Run("normalized keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[int](strings.ToLower))
+		trie.Insert("cat", 1)
+		added, removed, updated := trie.Sync(map[string]int{"CAT": 2, "Dog": 3}, eq)
+		assert.Equal(t, []int{1, 0, 1}, []int{added, removed, updated})
+		assert.Equal(t, map[string]int{"cat": 2, "dog": 3}, trie.ToMap())
+	})
+}
+
+func TestTrieRefreshKeys(t *testing.T) {
+	t.Run("surviving keys keep their values", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("ant", 1)
+		trie.Insert("bee", 2)
+		trie.Insert("cat", 3)
+		calls := []string{}
+		newValue := func(key string) int {
+			calls = append(calls, key)
+			return len(key) * 100
+		}
+		added, removed := trie.RefreshKeys([]string{"cat", "ant", "crow", "", "crow"}, newValue)
+		assert.Equal(t, 2, added)
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, map[string]int{"": 0, "ant": 1, "cat": 3, "crow": 400}, trie.ToMap())
+		assert.Equal(t, []string{"", "crow"}, calls)
+		assert.Equal(t, 4, trie.Len())
+
+		added, removed = trie.RefreshKeys(trie.GetAll(), newValue)
+		assert.Equal(t, []int{0, 0}, []int{added, removed})
+	})
+	t.Run("empty list removes every key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		added, removed := trie.RefreshKeys(nil, func(key string) string { return "new" })
+		assert.Equal(t, 0, added)
+		assert.Equal(t, 10, removed)
+		assert.True(t, trie.IsEmpty())
+		assert.Equal(t, 0, trie.NodeCount())
+	})
+	t.Run("normalized keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithKeyNormalizer[string](strings.ToLower))
+		trie.Insert("Cat", "kept")
+		trie.RefreshKeys([]string{"CAT", "Dog"}, func(key string) string { return "new " + key })
+		assert.Equal(t, map[string]string{"cat": "kept", "dog": "new dog"}, trie.ToMap())
+	})
+}
+
+func TestTrieTrimToSize(t *testing.T) {
+	byValue := func(key string, value int) int { return value }
+
+	t.Run("lowest scoring keys removed", func(t *testing.T) {
+		trie, _ := NewTrieFromMap(map[string]int{"apple": 5, "app": 1, "banana": 3, "band": 7, "ban": 2, "cat": 6})
+		assert.Equal(t, 3, trie.TrimToSize(3, byValue))
+		assert.Equal(t, map[string]int{"apple": 5, "band": 7, "cat": 6}, trie.ToMap())
+		assert.Equal(t, 0, countOrphans(trie.Root))
+	})
+	t.Run("ties removed in lexicographic order", func(t *testing.T) {
+		trie, _ := NewTrieFromMap(map[string]int{"c": 1, "a": 1, "b": 1})
+		assert.Equal(t, 2, trie.TrimToSize(1, byValue))
+		assert.Equal(t, []string{"c"}, trie.GetAll())
+	})
+	t.Run("nothing removed within size", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, 0, trie.TrimToSize(10, func(string, string) int { return 0 }))
+		assert.Equal(t, 10, trie.Len())
+	})
+	t.Run("trim to zero empties the trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, 10, trie.TrimToSize(0, func(key, _ string) int { return len(key) }))
+		assert.True(t, trie.IsEmpty())
+		assert.Equal(t, 0, trie.NodeCount())
+	})
+	t.Run("negative size empties the trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, 10, trie.TrimToSize(-1, func(string, string) int { return 0 }))
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func TestTrieASCIIFastPath(t *testing.T) {
+	t.Run("fast and rune paths build the same trie", func(t *testing.T) {
+		words := []string{"caat", "caalm", "héllo", "hello", "", "日本", "as"}
+		fast := NewTrie[int]()
+		runes := NewTrie[int]()
+		for i, word := range words {
+			assert.Nil(t, fast.Insert(word, i))
+			assert.Nil(t, runes.InsertRunes([]rune(word), i))
+		}
+		assert.Equal(t, runes.Pretty(), fast.Pretty())
+		for i, word := range words {
+			got, err := fast.SearchRunes([]rune(word))
+			assert.Nil(t, err)
+			assert.Equal(t, i, got)
+			got, err = runes.Search(word)
+			assert.Nil(t, err)
+			assert.Equal(t, i, got)
+		}
+		for _, word := range words {
+			_, err := fast.Delete(word)
+			assert.Nil(t, err)
+			_, err = runes.DeleteRunes([]rune(word))
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, 0, fast.NodeCount())
+		assert.Equal(t, 0, runes.NodeCount())
+	})
+	t.Run("options apply to ascii keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxKeyLen[int](3), WithAllowedRunes[int](func(r rune) bool { return r != 'x' }))
+		assert.ErrorIs(t, trie.Insert("abcd", 0), ErrKeyTooLong)
+		assert.ErrorIs(t, trie.Insert("axe", 0), ErrInvalidRune)
+		_, err := trie.Search("abcd")
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+		_, err = trie.Delete("axe")
+		assert.ErrorIs(t, err, ErrInvalidRune)
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func BenchmarkASCII(b *testing.B) {
+	words := benchmarkWords(10000)
+	trie := NewTrie[int]()
+	for j, word := range words {
+		trie.Insert(word, j)
+	}
+
+	b.Run("load/fast path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie := NewTrie[int]()
+			for j, word := range words {
+				trie.Insert(word, j)
+			}
+		}
+	})
+	b.Run("load/rune path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie := NewTrie[int]()
+			for j, word := range words {
+				trie.InsertRunes([]rune(word), j)
+			}
+		}
+	})
+	b.Run("search/fast path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie.Search(words[i%len(words)])
+		}
+	})
+	b.Run("search/rune path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trie.SearchRunes([]rune(words[i%len(words)]))
+		}
+	})
+}
+
+func TestTrieWalkOrdered(t *testing.T) {
+	collect := func(trie *Trie[string], order Order) []string {
+		keys := []string{}
+		err := trie.WalkOrdered(order, func(key string, value string) error {
+			keys = append(keys, key)
+			return nil
+		})
+		assert.Nil(t, err)
+		return keys
+	}
+
+	t.Run("pre-order", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, trie.GetAll(), collect(trie, PreOrder))
+	})
+	t.Run("post-order", func(t *testing.T) {
+		assert.Equal(t,
+			[]string{"ask", "as", "at", "caable", "caab", "caalcr", "caalcu", "caalc", "caalm", "caat"},
+			collect(newFixtureTrie(), PostOrder))
+	})
+	t.Run("level order", func(t *testing.T) {
+		assert.Equal(t,
+			[]string{"as", "at", "ask", "caab", "caat", "caalc", "caalm", "caable", "caalcr", "caalcu"},
+			collect(newFixtureTrie(), LevelOrder))
+	})
+	t.Run("empty key", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("", "")
+		trie.Insert("a", "")
+		assert.Equal(t, []string{"", "a"}, collect(trie, PreOrder))
+		assert.Equal(t, []string{"a", ""}, collect(trie, PostOrder))
+		assert.Equal(t, []string{"", "a"}, collect(trie, LevelOrder))
+	})
+	t.Run("error stops the walk", func(t *testing.T) {
+		errStop := errors.New("stop")
+		for _, order := range []Order{PreOrder, PostOrder, LevelOrder} {
+			calls := 0
+			err := newFixtureTrie().WalkOrdered(order, func(key string, value string) error {
+				calls++
+				return errStop
+			})
+			assert.Equal(t, errStop, err)
+			assert.Equal(t, 1, calls)
+		}
+	})
+	t.Run("unknown order", func(t *testing.T) {
+		err := newFixtureTrie().WalkOrdered(Order(10), func(string, string) error { return nil })
+		assert.NotNil(t, err)
+	})
+}
+
+func TestTrieDeepestValueAlong(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("/etc/app/config", "file")
+	// store an inherited default on an inner node
+	node, _ := trie.NodeAt("/etc")
+	node.Value = "etc default"
+
+	t.Run("path diverging partway", func(t *testing.T) {
+		value, depth, ok := trie.DeepestValueAlong("/etc/other")
+		assert.True(t, ok)
+		assert.Equal(t, 5, depth)
+		assert.Equal(t, "", value)
+
+		value, depth, ok = trie.DeepestValueAlong("/etcetera")
+		assert.True(t, ok)
+		assert.Equal(t, 4, depth)
+		assert.Equal(t, "etc default", value)
+	})
+	t.Run("path reaching a key and beyond", func(t *testing.T) {
+		value, depth, ok := trie.DeepestValueAlong("/etc/app/config.d/extra")
+		assert.True(t, ok)
+		assert.Equal(t, len("/etc/app/config"), depth)
+		assert.Equal(t, "file", value)
+	})
+	t.Run("no matching rune", func(t *testing.T) {
+		value, depth, ok := trie.DeepestValueAlong("usr")
+		assert.False(t, ok)
+		assert.Equal(t, 0, depth)
+		assert.Equal(t, "", value)
+		_, _, ok = trie.DeepestValueAlong("")
+		assert.False(t, ok)
+	})
+}
+
+func TestTrieSoftDelete(t *testing.T) {
+	t.Run("undelete restores the original value", func(t *testing.T) {
+		trie := newFixtureTrie()
+		want, _ := trie.Search("caalc")
+		assert.Nil(t, trie.SoftDelete("caalc"))
+		assert.NotContains(t, trie.GetAll(), "caalc")
+		assert.False(t, trie.Contains("caalc"))
+		assert.Equal(t, 9, trie.Len())
+
+		assert.Nil(t, trie.Undelete("caalc"))
+		got, err := trie.Search("caalc")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+		assert.Equal(t, newFixtureTrie().GetAll(), trie.GetAll())
+	})
+	t.Run("leaf node is kept until pruned", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Nil(t, trie.SoftDelete("caable"))
+		assert.Equal(t, 16, trie.NodeCount())
+		trie.Prune()
+		assert.ErrorIs(t, trie.Undelete("caable"), ErrNotFound)
+	})
+	t.Run("undelete needs a soft deleted key", func(t *testing.T) {
+		trie := newFixtureTrie()
+		// a prefix which was never a key
+		assert.ErrorIs(t, trie.Undelete("caal"), ErrNotFound)
+		assert.ErrorIs(t, trie.Undelete("caalc"), ErrNotFound)
+		assert.ErrorIs(t, trie.SoftDelete("caal"), ErrNotFound)
+
+		// reinserting replaces the soft deleted value
+		trie.SoftDelete("caalc")
+		trie.Insert("caalc", "new")
+		assert.ErrorIs(t, trie.Undelete("caalc"), ErrNotFound)
+		got, _ := trie.Search("caalc")
+		assert.Equal(t, "new", got)
+	})
+}
+
+func TestTrieMerge(t *testing.T) {
+	t.Run("duplicate insert merges values", func(t *testing.T) {
+		trie := NewTrieWithMerge(func(existing, incoming int) int { return existing + incoming })
+		assert.Nil(t, trie.Insert("count", 1))
+		seq, _ := trie.Sequence("count")
+		assert.Nil(t, trie.Insert("count", 2))
+		assert.Nil(t, trie.InsertRunes([]rune("count"), 3))
+		got, _ := trie.Search("count")
+		assert.Equal(t, 6, got)
+		newSeq, _ := trie.Sequence("count")
+		assert.Equal(t, seq, newSeq)
+		assert.Equal(t, 1, trie.Len())
+	})
+	t.Run("merge accumulates sets", func(t *testing.T) {
+		trie := NewTrieWithMerge(func(existing, incoming []string) []string { return append(existing, incoming...) })
+		trie.Insert("日本", []string{"japan"})
+		trie.Insert("日本", []string{"nihon", "nippon"})
+		got, _ := trie.Search("日本")
+		assert.Equal(t, []string{"japan", "nihon", "nippon"}, got)
+	})
+	t.Run("default still errors", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("count", 1)
+		assert.ErrorIs(t, trie.Insert("count", 2), ErrAlreadyExists)
+		got, _ := trie.Search("count")
+		assert.Equal(t, 1, got)
+	})
+}
+
+func TestTrieInterned(t *testing.T) {
+	seed := maphash.MakeSeed()
+	hash := func(s string) uint64 { return maphash.String(seed, s) }
+	eq := func(a, b string) bool { return a == b }
+	// categories returns a new copy of the i'th of a few category strings, so equal values don't share memory
+	categories := []string{"fruit", "vegetable", "grain"}
+	category := func(i int) string {
+		return strings.Clone(categories[i%len(categories)])
+	}
+
+	t.Run("equal values share one copy", func(t *testing.T) {
+		trie := NewTrieInterned(hash, eq)
+		for i, word := range benchmarkWords(300) {
+			assert.Nil(t, trie.Insert(word, category(i)))
+		}
+		shared := map[string]*byte{}
+		trie.Walk(func(key string, value string) error {
+			if data, ok := shared[value]; ok {
+				assert.Same(t, data, unsafe.StringData(value), key)
+			}
+			shared[value] = unsafe.StringData(value)
+			return nil
+		})
+		assert.Equal(t, len(categories), len(shared))
+		assert.Equal(t, len(categories), len(trie.interner.values))
+	})
+	t.Run("values set after insert are interned", func(t *testing.T) {
+		trie := NewTrieInterned(hash, eq)
+		trie.Insert("apple", category(0))
+		trie.Insert("bread", category(1))
+		trie.SetValue("bread", category(0))
+		trie.Insert("carrot", category(1))
+		trie.CompareAndSwap("carrot", "vegetable", category(0), eq)
+
+		apple, _ := trie.Search("apple")
+		for _, key := range []string{"bread", "carrot"} {
+			got, _ := trie.Search(key)
+			assert.Equal(t, "fruit", got)
+			assert.Same(t, unsafe.StringData(apple), unsafe.StringData(got), key)
+		}
+	})
+	t.Run("copies intern apart", func(t *testing.T) {
+		trie := NewTrieInterned(hash, eq)
+		trie.Insert("apple", category(0))
+		clone := trie.Clone()
+		sub, _ := trie.SubTrie("a", true)
+		assert.NotSame(t, trie.interner, clone.interner)
+		assert.NotSame(t, trie.interner, sub.interner)
+
+		var wg sync.WaitGroup
+		for _, trie := range []*Trie[string]{trie, clone, sub} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i, word := range benchmarkWords(100) {
+					trie.Insert(word, category(i))
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, len(categories), len(trie.interner.values))
+		assert.Equal(t, len(categories), len(clone.interner.values))
+	})
+	t.Run("increment sums are not interned", func(t *testing.T) {
+		trie := NewTrieInterned(func(n int) uint64 { return uint64(n) }, func(a, b int) bool { return a == b })
+		add := func(a, b int) int { return a + b }
+		for range 100 {
+			trie.Increment("hits", 1, add)
+		}
+		got, _ := trie.Search("hits")
+		assert.Equal(t, 100, got)
+		assert.Equal(t, 1, len(trie.interner.values))
+	})
+	t.Run("without interning values are kept as inserted", func(t *testing.T) {
+		trie := NewTrie[string]()
+		trie.Insert("apple", category(0))
+		trie.Insert("banana", category(0))
+		apple, _ := trie.Search("apple")
+		banana, _ := trie.Search("banana")
+		assert.NotSame(t, unsafe.StringData(apple), unsafe.StringData(banana))
+	})
+}
+
+func TestCommonKeys(t *testing.T) {
+	t.Run("overlapping keys", func(t *testing.T) {
+		set, _ := NewStringSet("as", "ask", "caa", "caalc", "dog")
+		allowed := set.trie
+		values := newFixtureTrie()
+		assert.Equal(t, []string{"as", "ask", "caalc"}, CommonKeys(allowed, values))
+		assert.Equal(t, []string{"as", "ask", "caalc"}, CommonKeys(values, allowed))
+	})
+	t.Run("disjoint keys", func(t *testing.T) {
+		other, _ := NewTrieFromMap(map[string]int{"dog": 1, "cat": 2, "ca": 3, "a": 4})
+		assert.Equal(t, []string{}, CommonKeys(newFixtureTrie(), other))
+	})
+	t.Run("empty key", func(t *testing.T) {
+		a, _ := NewTrieFromMap(map[string]int{"": 1, "x": 2})
+		b, _ := NewTrieFromMap(map[string]bool{"": true, "y": false})
+		assert.Equal(t, []string{""}, CommonKeys(a, b))
+	})
+}
+
+func TestTrieValidate(t *testing.T) {
+	t.Run("valid tries", func(t *testing.T) {
+		assert.Nil(t, NewTrie[int]().Validate())
+		trie := newFixtureTrie()
+		assert.Nil(t, trie.Validate())
+		trie.SoftDelete("caable")
+		assert.Nil(t, trie.Validate())
+
+		wide := NewTrie[int]()
+		for r := rune(0x4E00); r < 0x4E00+childMapThreshold*2; r++ {
+			wide.Insert(string(r), 0)
+		}
+		assert.Nil(t, wide.Validate())
+	})
+	corruptions := map[string]func(trie *Trie[string]){
+		"nil child": func(trie *Trie[string]) {
+			node, _ := trie.NodeAt("caal")
+			node.Children[0] = nil
+		},
+		"duplicate rune": func(trie *Trie[string]) {
+			node, _ := trie.NodeAt("caal")
+			node.Children[1].KeyRune = node.Children[0].KeyRune
+		},
+		"unsorted children": func(trie *Trie[string]) {
+			node, _ := trie.NodeAt("caal")
+			node.Children[0], node.Children[1] = node.Children[1], node.Children[0]
+		},
+		"missing rune": func(trie *Trie[string]) {
+			node, _ := trie.NodeAt("caable")
+			node.KeyRune = 0
+		},
+		"leaf which is not a key": func(trie *Trie[string]) {
+			node, _ := trie.NodeAt("caalcu")
+			node.IsEnd = false
+		},
+	}
+	for name, corrupt := range corruptions {
+		t.Run(name, func(t *testing.T) {
+			trie := newFixtureTrie()
+			corrupt(trie)
+			err := trie.Validate()
+			assert.ErrorIs(t, err, ErrCorruptTrie)
+			assert.Contains(t, err.Error(), `"caa`)
+		})
+	}
+}
+
+func TestTriePopPrefix(t *testing.T) {
+	t.Run("removed entries returned and the rest intact", func(t *testing.T) {
+		trie, _ := NewTrieFromMap(map[string]int{"ns/a": 1, "ns/b/c": 2, "ns": 3, "nsx": 4, "other": 5})
+		entries, err := trie.PopPrefix("ns/")
+		assert.Nil(t, err)
+		assert.Equal(t, []Entry[int]{{Key: "ns/a", Value: 1}, {Key: "ns/b/c", Value: 2}}, entries)
+		assert.Equal(t, map[string]int{"ns": 3, "nsx": 4, "other": 5}, trie.ToMap())
+		assert.Nil(t, trie.Validate())
+	})
+	t.Run("prefix which is a key is removed with its ancestors", func(t *testing.T) {
+		trie := newFixtureTrie()
+		entries, err := trie.PopPrefix("caa")
+		assert.Nil(t, err)
+		assert.Equal(t, 7, len(entries))
+		assert.Equal(t, []string{"as", "ask", "at"}, trie.GetAll())
+		assert.Equal(t, 4, trie.NodeCount())
+		assert.Nil(t, trie.Validate())
+	})
+	t.Run("empty prefix empties the trie", func(t *testing.T) {
+		trie := newFixtureTrie()
+		entries, err := trie.PopPrefix("")
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(entries))
+		assert.True(t, trie.IsEmpty())
+		assert.Equal(t, 0, trie.NodeCount())
+	})
+	t.Run("absent prefix returns error", func(t *testing.T) {
+		trie := newFixtureTrie()
+		entries, err := trie.PopPrefix("dog")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Nil(t, entries)
+		assert.Equal(t, 10, trie.Len())
+	})
+}
+
+func TestTrieResolve(t *testing.T) {
+	newConfig := func() *Trie[string] {
+		trie := NewTrie[string]()
+		trie.SetPrefixValue("", "info")
+		trie.SetPrefixValue("log.", "warn")
+		trie.SetPrefixValue("log.db.", "error")
+		trie.Insert("log.db.slow", "debug")
+		return trie
+	}
+
+	t.Run("inherits the deepest prefix value", func(t *testing.T) {
+		trie := newConfig()
+		assert.Equal(t, "warn", trie.Resolve("log.http"))
+		assert.Equal(t, "error", trie.Resolve("log.db.pool"))
+		assert.Equal(t, "error", trie.Resolve("log.db."))
+		assert.Equal(t, "info", trie.Resolve("metrics"))
+	})
+	t.Run("key value overrides prefix values", func(t *testing.T) {
+		trie := newConfig()
+		assert.Equal(t, "debug", trie.Resolve("log.db.slow"))
+		trie.SetPrefixValue("log.db.slow", "ignored")
+		assert.Equal(t, "debug", trie.Resolve("log.db.slow"))
+		assert.Equal(t, "ignored", trie.Resolve("log.db.slower"))
+	})
+	t.Run("prefix value can be replaced", func(t *testing.T) {
+		trie := newConfig()
+		trie.SetPrefixValue("log.", "trace")
+		assert.Equal(t, "trace", trie.Resolve("log.http"))
+	})
+	t.Run("prefix values are not keys", func(t *testing.T) {
+		trie := newConfig()
+		assert.Equal(t, []string{"log.db.slow"}, trie.GetAll())
+		assert.Nil(t, trie.Validate())
+		assert.Equal(t, "", NewTrie[string]().Resolve("log.http"))
+	})
+}
+
+func TestTrieWalkPaths(t *testing.T) {
+	collect := func(trie *Trie[int]) map[string][]int {
+		paths := map[string][]int{}
+		trie.WalkPaths(func(key string, pathValues []int) {
+			paths[key] = slices.Clone(pathValues)
+		})
+		return paths
+	}
+
+	t.Run("prefix values on internal nodes", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("usr/bin", 3)
+		trie.Insert("usr/lib", 4)
+		trie.Insert("var", 5)
+		trie.SetPrefixValue("", 1)
+		trie.SetPrefixValue("usr", 2)
+		assert.Equal(t, map[string][]int{
+			"usr/bin": {1, 0, 0, 2, 0, 0, 0, 3},
+			"usr/lib": {1, 0, 0, 2, 0, 0, 0, 4},
+			"var":     {1, 0, 0, 5},
+		}, collect(trie))
+	})
+	t.Run("keys on the path", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("", 1)
+		trie.Insert("ab", 2)
+		trie.Insert("abc", 3)
+		// the key's own value wins over a prefix value, like Resolve
+		trie.SetPrefixValue("ab", 10)
+		trie.SetPrefixValue("a", 20)
+		assert.Equal(t, map[string][]int{
+			"":    {1},
+			"ab":  {1, 20, 2},
+			"abc": {1, 20, 2, 3},
+		}, collect(trie))
+	})
+	t.Run("keys in lexicographic order", func(t *testing.T) {
+		trie := newFixtureTrie()
+		keys := []string{}
+		trie.WalkPaths(func(key string, pathValues []string) {
+			keys = append(keys, key)
+			assert.Equal(t, utf8.RuneCountInString(key)+1, len(pathValues), key)
+			assert.Equal(t, "ok", pathValues[len(pathValues)-1], key)
+		})
+		assert.Equal(t, trie.GetAll(), keys)
+	})
+}
+
+func TestTrieMaxNodes(t *testing.T) {
+	t.Run("inserts fail past the budget", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxNodes[int](5))
+		assert.Nil(t, trie.Insert("car", 1))
+		assert.Nil(t, trie.Insert("cat", 2))
+		// "cats" only needs one more node, which fills the budget
+		assert.Nil(t, trie.Insert("cats", 3))
+		assert.Equal(t, 5, trie.NodeCount())
+
+		err := trie.Insert("d", 4)
+		assert.ErrorIs(t, err, ErrTrieFull)
+		assert.Equal(t, &KeyError{Key: "d", Err: ErrTrieFull}, err)
+		// a partially existing path is not inserted either
+		assert.ErrorIs(t, trie.Insert("carts", 4), ErrTrieFull)
+		assert.Equal(t, 5, trie.NodeCount())
+		assert.Equal(t, []string{"car", "cat", "cats"}, trie.GetAll())
+		// keys on existing nodes need no capacity
+		assert.Nil(t, trie.Insert("ca", 4))
+	})
+	t.Run("deletes free capacity", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxNodes[int](4))
+		assert.Nil(t, trie.Insert("ab", 1))
+		assert.Nil(t, trie.Insert("cd", 2))
+		assert.ErrorIs(t, trie.Insert("e", 3), ErrTrieFull)
+		_, err := trie.Delete("ab")
+		assert.Nil(t, err)
+		assert.Nil(t, trie.Insert("e", 3))
+		assert.Nil(t, trie.Insert("f", 4))
+		assert.ErrorIs(t, trie.Insert("g", 5), ErrTrieFull)
+
+		trie.DeleteIf(func(key string, value int) bool { return value > 2 })
+		assert.Nil(t, trie.Insert("gh", 5))
+		trie.Clear()
+		assert.Nil(t, trie.Insert("wxyz", 6))
+	})
+	t.Run("counter follows every mutation", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxNodes[int](100))
+		for i, key := range []string{"tea", "ted", "ten", "to", "tone", "inn", "in"} {
+			assert.Nil(t, trie.Insert(key, i))
+		}
+		assert.Nil(t, trie.Rename("tone", "tonal"))
+		trie.DeleteRunes([]rune("inn"))
+		trie.DeleteAndCheck("ted")
+		trie.PopPrefix("te")
+		trie.SoftDelete("to")
+		trie.Prune()
+		assert.Equal(t, trie.NodeCount(), trie.nodes)
+
+		sub, err := trie.SubTrie("t", true)
+		assert.Nil(t, err)
+		assert.Equal(t, sub.NodeCount(), sub.nodes)
+	})
+}
+
+func TestTrieAncestors(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("/", "read")
+	trie.Insert("/home", "write")
+	trie.Insert("/home/ann", "admin")
+	trie.Insert("/homework", "none")
+
+	t.Run("nested stored prefixes", func(t *testing.T) {
+		want := []Entry[string]{{"/", "read"}, {"/home", "write"}}
+		assert.Equal(t, want, trie.Ancestors("/home/ann"))
+		assert.Equal(t, want, trie.Ancestors("/home/bob"))
+		assert.Equal(t, []Entry[string]{{"/", "read"}}, trie.Ancestors("/home"))
+	})
+	t.Run("no ancestors", func(t *testing.T) {
+		assert.Equal(t, []Entry[string]{}, trie.Ancestors("/"))
+		assert.Equal(t, []Entry[string]{}, trie.Ancestors("etc"))
+		assert.Equal(t, []Entry[string]{}, trie.Ancestors(""))
+	})
+	t.Run("the empty key is an ancestor of every other key", func(t *testing.T) {
+		trie.Insert("", "none")
+		assert.Equal(t, []Entry[string]{{"", "none"}, {"/", "read"}}, trie.Ancestors("/h"))
+	})
+}
+
+func TestTrieLoadLines(t *testing.T) {
+	t.Run("loads trimmed non-empty lines", func(t *testing.T) {
+		trie := NewTrie[int]()
+		count, err := trie.LoadLines(strings.NewReader("cat\n  car \r\n\n\t\ncart\ncat\n"), func(key string) int { return len(key) })
+		assert.Nil(t, err)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, map[string]int{"car": 3, "cart": 4, "cat": 3}, trie.ToMap())
+	})
+	t.Run("skips existing keys", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("car", 0)
+		count, err := trie.LoadLines(strings.NewReader("car\ncat"), func(key string) int { return 1 })
+		assert.Nil(t, err)
+		assert.Equal(t, 1, count)
+		got, _ := trie.Search("car")
+		assert.Equal(t, 0, got)
+	})
+	t.Run("rejected keys don't stop the load", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxKeyLen[int](3))
+		count, err := trie.LoadLines(strings.NewReader("cart\ncat\ncarts\ncar"), func(key string) int { return 1 })
+		assert.ErrorIs(t, err, ErrKeyTooLong)
+		assert.ErrorContains(t, err, `"cart"`)
+		assert.ErrorContains(t, err, `"carts"`)
+		assert.Equal(t, 2, count)
+		assert.Equal(t, []string{"car", "cat"}, trie.GetAll())
+	})
+	t.Run("read errors are returned", func(t *testing.T) {
+		trie := NewTrie[int]()
+		count, err := trie.LoadLines(strings.NewReader(strings.Repeat("a", bufio.MaxScanTokenSize+1)), func(key string) int { return 1 })
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+		assert.Equal(t, 0, count)
+	})
+}
+
+func TestTrieSimilarity(t *testing.T) {
+	t.Run("identical keys", func(t *testing.T) {
+		other := newFixtureTrie()
+		other.SetValue("as", "changed")
+		assert.Equal(t, 1.0, newFixtureTrie().Similarity(other))
+		assert.Equal(t, 1.0, NewTrie[int]().Similarity(NewTrie[int]()))
+	})
+	t.Run("disjoint keys", func(t *testing.T) {
+		other, _ := NewTrieFromMap(map[string]string{"dog": "", "cat": "", "ca": "", "a": ""})
+		assert.Equal(t, 0.0, newFixtureTrie().Similarity(other))
+		assert.Equal(t, 0.0, newFixtureTrie().Similarity(NewTrie[string]()))
+	})
+	t.Run("partial overlap", func(t *testing.T) {
+		a, _ := NewTrieFromMap(map[string]int{"": 1, "ab": 1, "abc": 1, "b": 1})
+		b, _ := NewTrieFromMap(map[string]int{"": 2, "abc": 2, "abd": 2, "c": 2})
+		// 2 shared keys out of 6 distinct ones
+		assert.InDelta(t, 2.0/6, a.Similarity(b), 1e-9)
+		assert.Equal(t, a.Similarity(b), b.Similarity(a))
+	})
+}
+
+func TestAppendValue(t *testing.T) {
+	t.Run("appends in order", func(t *testing.T) {
+		trie := NewTrie[[]int]()
+		for i := range 3 {
+			assert.Nil(t, AppendValue(trie, "a", i))
+		}
+		assert.Nil(t, AppendValue(trie, "ab", 10))
+		got, _ := trie.Search("a")
+		assert.Equal(t, []int{0, 1, 2}, got)
+		got, _ = trie.Search("ab")
+		assert.Equal(t, []int{10}, got)
+	})
+	t.Run("the same through a merge function", func(t *testing.T) {
+		trie := NewTrieWithMerge(func(a, b []int) []int { return append(a, b...) })
+		for i := range 3 {
+			assert.Nil(t, trie.Insert("a", []int{i}))
+		}
+		got, _ := trie.Search("a")
+		assert.Equal(t, []int{0, 1, 2}, got)
+	})
+	t.Run("rejected keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxKeyLen[[]int](1))
+		assert.ErrorIs(t, AppendValue(trie, "ab", 1), ErrKeyTooLong)
+		assert.True(t, trie.IsEmpty())
+	})
+}
+
+func TestTrieDeleteAndCount(t *testing.T) {
+	trie := NewTrie[int]()
+	for i, key := range []string{"ca", "cat", "catalog", "dog", "zebra"} {
+		trie.Insert(key, i)
+	}
+	t.Run("unique key frees its whole chain", func(t *testing.T) {
+		val, removed, err := trie.DeleteAndCount("zebra")
+		assert.Nil(t, err)
+		assert.Equal(t, 4, val)
+		assert.Equal(t, 5, removed)
+	})
+	t.Run("key on a shared path frees nothing", func(t *testing.T) {
+		_, removed, err := trie.DeleteAndCount("cat")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, removed)
+	})
+	t.Run("frees up to the nearest node still in use", func(t *testing.T) {
+		// "cat" is no longer a key, so "catalog" frees everything below "ca"
+		_, removed, err := trie.DeleteAndCount("catalog")
+		assert.Nil(t, err)
+		assert.Equal(t, 5, removed)
+		assert.Equal(t, 5, trie.NodeCount())
+	})
+	t.Run("missing key", func(t *testing.T) {
+		_, removed, err := trie.DeleteAndCount("cow")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 0, removed)
+	})
+}
+
+func TestTrieDeleteImpact(t *testing.T) {
+	t.Run("matches the nodes Delete removes", func(t *testing.T) {
+		for _, key := range newFixtureTrie().GetAll() {
+			trie := newFixtureTrie()
+			want, err := trie.DeleteImpact(key)
+			assert.Nil(t, err, key)
+			// the prediction leaves the trie as it was
+			assert.Equal(t, newFixtureTrie().NodeCount(), trie.NodeCount(), key)
+
+			before := trie.NodeCount()
+			trie.Delete(key)
+			assert.Equal(t, want, before-trie.NodeCount(), key)
+		}
+	})
+	t.Run("deletes in sequence", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, key := range []string{"ca", "cat", "catalog", "dog"} {
+			trie.Insert(key, i)
+		}
+		for _, key := range []string{"cat", "catalog", "ca", "dog"} {
+			want, err := trie.DeleteImpact(key)
+			assert.Nil(t, err, key)
+			_, removed, _ := trie.DeleteAndCount(key)
+			assert.Equal(t, removed, want, key)
+		}
+		assert.Equal(t, 0, trie.NodeCount())
+	})
+	t.Run("missing keys", func(t *testing.T) {
+		trie := newFixtureTrie()
+		for _, key := range []string{"cow", "caal", ""} {
+			removed, err := trie.DeleteImpact(key)
+			assert.ErrorIs(t, err, ErrNotFound, key)
+			assert.Equal(t, 0, removed)
+		}
+	})
+}
+
+func TestTrieBestCompletion(t *testing.T) {
+	trie := NewTrie[int]()
+	for _, key := range []string{"car", "card", "care", "careful", "cat", "dog"} {
+		trie.Insert(key, 0)
+	}
+
+	t.Run("first match", func(t *testing.T) {
+		got, ok := trie.BestCompletion("ca", nil)
+		assert.True(t, ok)
+		assert.Equal(t, "car", got)
+		got, _ = trie.BestCompletion("care", nil)
+		assert.Equal(t, "care", got)
+		got, _ = trie.BestCompletion("", nil)
+		assert.Equal(t, "car", got)
+	})
+	t.Run("comparator", func(t *testing.T) {
+		longest := func(a, b string) bool { return len(a) > len(b) }
+		got, ok := trie.BestCompletion("car", longest)
+		assert.True(t, ok)
+		assert.Equal(t, "careful", got)
+		// ties keep the first key in lexicographic order
+		got, _ = trie.BestCompletion("ca", func(a, b string) bool { return len(a) < len(b) })
+		assert.Equal(t, "car", got)
+	})
+	t.Run("no completion", func(t *testing.T) {
+		_, ok := trie.BestCompletion("cow", nil)
+		assert.False(t, ok)
+		_, ok = trie.BestCompletion("cow", func(a, b string) bool { return a < b })
+		assert.False(t, ok)
+	})
+	t.Run("first match stops early", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("aa", 0)
+		trie.Insert("ab", 0)
+		poisonChildren(trie.Root.Children[0])
+		assert.NotPanics(t, func() {
+			got, _ := trie.BestCompletion("a", nil)
+			assert.Equal(t, "aa", got)
+		})
+	})
+}
+
+func TestTrieRepair(t *testing.T) {
+	t.Run("merges duplicate siblings recursively", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("cab", 1)
+		trie.Insert("cat", 2)
+		other := NewTrie[int]()
+		other.Insert("ca", 3)
+		other.Insert("cab", 4)
+		other.Insert("car", 5)
+		other.Insert("dog", 6)
+		// graft other's children next to trie's, giving two "c" nodes, each with an "a" child and a "b" below it
+		trie.Root.Children = append(trie.Root.Children, other.Root.Children...)
+		assert.ErrorIs(t, trie.Validate(), ErrCorruptTrie)
+		_, err := trie.Search("ca")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// "c", then "ca", then "cab"
+		assert.Equal(t, 3, trie.Repair())
+		assert.Nil(t, trie.Validate())
+		want := map[string]int{"ca": 3, "cab": 1, "car": 5, "cat": 2, "dog": 6}
+		assert.Equal(t, want, trie.ToMap())
+		for key, value := range want {
+			got, err := trie.Search(key)
+			assert.Nil(t, err)
+			assert.Equal(t, value, got)
+		}
+		assert.Equal(t, 8, trie.NodeCount())
+	})
+	t.Run("duplicates apart from each other", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, key := range []string{"a", "b", "c"} {
+			trie.Insert(key, 0)
+		}
+		trie.Root.Children[2].KeyRune = 'a'
+		assert.Equal(t, 1, trie.Repair())
+		assert.Equal(t, []string{"a", "b"}, trie.GetAll())
+	})
+	t.Run("drops nil children", func(t *testing.T) {
+		trie := newFixtureTrie()
+		poisonChildren(trie.Root)
+		poisonChildren(trie.Root.Children[0])
+		assert.ErrorIs(t, trie.Validate(), ErrCorruptTrie)
+		assert.Equal(t, 0, trie.Repair())
+		assert.Nil(t, trie.Validate())
+		assert.Equal(t, newFixtureTrie().ToMap(), trie.ToMap())
+		assert.Equal(t, newFixtureTrie().NodeCount(), trie.NodeCount())
+	})
+	t.Run("valid trie is unchanged", func(t *testing.T) {
+		trie := newFixtureTrie()
+		assert.Equal(t, 0, trie.Repair())
+		assert.Equal(t, newFixtureTrie().ToMap(), trie.ToMap())
+	})
+}
+
+func TestTrieHooks(t *testing.T) {
+	type call struct {
+		op  string
+		key string
+		hit bool
+	}
+	calls := []call{}
+	record := func(op string) func(string, bool) {
+		return func(key string, hit bool) {
+			calls = append(calls, call{op, key, hit})
+		}
+	}
+	trie := NewTrieWithOptions(WithMaxKeyLen[int](5), WithHooks[int](Hooks{
+		OnInsert: record("insert"),
+		OnSearch: record("search"),
+		OnDelete: record("delete"),
+	}))
+
+	trie.Insert("cat", 1)
+	trie.Insert("cat", 2)
+	trie.Insert("toolong", 3)
+	trie.InsertRunes([]rune("café"), 4)
+	trie.Search("cat")
+	trie.Search("dog")
+	trie.SearchRunes([]rune("café"))
+	trie.Delete("café")
+	trie.Delete("café")
+	trie.DeleteRunes([]rune("cat"))
+	assert.Equal(t, []call{
+		{"insert", "cat", true},
+		{"insert", "cat", false},
+		{"insert", "toolong", false},
+		{"insert", "café", true},
+		{"search", "cat", true},
+		{"search", "dog", false},
+		{"search", "café", true},
+		{"delete", "café", true},
+		{"delete", "café", false},
+		{"delete", "cat", true},
+	}, calls)
+
+	t.Run("nil hooks are skipped", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithHooks[int](Hooks{OnSearch: record("search")}))
+		calls = []call{}
+		assert.NotPanics(t, func() {
+			trie.Insert("a", 1)
+			trie.Search("a")
+			trie.Delete("a")
+		})
+		assert.Equal(t, []call{{"search", "a", true}}, calls)
+	})
+	t.Run("only the documented methods run hooks", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithHooks[int](Hooks{
+			OnInsert: record("insert"),
+			OnSearch: record("search"),
+			OnDelete: record("delete"),
+		}))
+		calls = []call{}
+		trie.LoadLines(strings.NewReader("a\nb\n"), func(string) int { return 0 })
+		trie.GetOrDefault("a", 1)
+		trie.Resolve("c")
+		trie.DeleteAll([]string{"a", "c"})
+		trie.InsertOrGet("d", 1)
+		trie.SetValue("d", 2)
+		trie.Increment("d", 1, func(a, b int) int { return a + b })
+		trie.Contains("d")
+		trie.GetRef("d")
+		trie.DeleteIf(func(string, int) bool { return true })
+		assert.Equal(t, []call{
+			{"insert", "a", true},
+			{"insert", "b", true},
+			{"search", "a", true},
+			{"search", "c", false},
+			{"delete", "a", true},
+			{"delete", "c", false},
+		}, calls)
+	})
+}
+
+func TestTrieFrontCode(t *testing.T) {
+	decode := func(codes []FrontCodedKey) []string {
+		keys := []string{}
+		prev := []rune{}
+		for _, code := range codes {
+			prev = append(prev[:code.Shared], []rune(code.Suffix)...)
+			keys = append(keys, string(prev))
+		}
+		return keys
+	}
+
+	t.Run("shared prefixes", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, key := range []string{"car", "card", "care", "cat", "dog", "do"} {
+			trie.Insert(key, 0)
+		}
+		want := []FrontCodedKey{{0, "car"}, {3, "d"}, {3, "e"}, {2, "t"}, {0, "do"}, {2, "g"}}
+		assert.Equal(t, want, trie.FrontCode())
+		assert.Equal(t, trie.GetAll(), decode(trie.FrontCode()))
+	})
+	t.Run("round trip", func(t *testing.T) {
+		for _, trie := range []*Trie[string]{newFixtureTrie(), NewTrie[string]()} {
+			assert.Equal(t, trie.GetAll(), decode(trie.FrontCode()))
+		}
+		trie := NewTrie[int]()
+		for _, key := range []string{"", "日本", "日本語", "日曜"} {
+			trie.Insert(key, 0)
+		}
+		assert.Equal(t, []FrontCodedKey{{0, ""}, {0, "日曜"}, {1, "本"}, {2, "語"}}, trie.FrontCode())
+		assert.Equal(t, trie.GetAll(), decode(trie.FrontCode()))
+	})
+}
+
+func TestTrieGetRef(t *testing.T) {
+	type stats struct {
+		hits  int
+		names []string
+	}
+	t.Run("changes through the pointer are stored", func(t *testing.T) {
+		trie := NewTrie[stats]()
+		trie.Insert("page", stats{})
+		for _, name := range []string{"ann", "bob"} {
+			ref, ok := trie.GetRef("page")
+			assert.True(t, ok)
+			ref.hits++
+			ref.names = append(ref.names, name)
+		}
+		got, err := trie.Search("page")
+		assert.Nil(t, err)
+		assert.Equal(t, stats{hits: 2, names: []string{"ann", "bob"}}, got)
+	})
+	t.Run("missing keys", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("abc", 1)
+		for _, key := range []string{"ab", "abcd", "x", "a\x00"} {
+			ref, ok := trie.GetRef(key)
+			assert.False(t, ok, key)
+			assert.Nil(t, ref, key)
+		}
+	})
+	t.Run("deleting the key detaches the pointer", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("abc", 1)
+		ref, _ := trie.GetRef("abc")
+		trie.Delete("abc")
+		*ref = 5
+		trie.Insert("abc", 2)
+		got, _ := trie.Search("abc")
+		assert.Equal(t, 2, got)
+	})
+}
+
+func TestTrieSearchLenient(t *testing.T) {
+	trie := NewTrie[int]()
+	trie.Insert("cart", 1)
+	trie.Insert("car", 2)
+
+	t.Run("keys", func(t *testing.T) {
+		got, ok := trie.SearchLenient("car")
+		assert.True(t, ok)
+		assert.Equal(t, 2, got)
+	})
+	t.Run("internal prefix", func(t *testing.T) {
+		got, ok := trie.SearchLenient("ca")
+		assert.True(t, ok)
+		assert.Equal(t, 0, got)
+		_, err := trie.Search("ca")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		node, _ := trie.NodeAt("ca")
+		node.Value = 5
+		got, ok = trie.SearchLenient("ca")
+		assert.True(t, ok)
+		assert.Equal(t, 5, got)
+	})
+	t.Run("missing path", func(t *testing.T) {
+		_, ok := trie.SearchLenient("cat")
+		assert.False(t, ok)
+		_, ok = trie.SearchLenient("carts")
+		assert.False(t, ok)
+	})
+}
+
+func TestTrieFanout(t *testing.T) {
+	trie := NewTrieWithFanout[int](4)
+	for i, key := range []string{"car", "cat", "cab", "dog"} {
+		assert.Nil(t, trie.Insert(key, i))
+	}
+	assert.Nil(t, trie.InsertRunes([]rune("café"), 4))
+	assert.Equal(t, []string{"cab", "café", "car", "cat", "dog"}, trie.GetAll())
+
+	node, _ := trie.NodeAt("ca")
+	assert.Equal(t, 4, cap(node.Children))
+	// leaves have no room reserved
+	node, _ = trie.NodeAt("cat")
+	assert.Equal(t, 0, cap(node.Children))
+	// nodes with more children than the hint grow as usual
+	node, _ = trie.NodeAt("ca")
+	assert.Nil(t, trie.Insert("cay", 5))
+	assert.Equal(t, 5, len(node.Children))
+}
+
+func BenchmarkFanout(b *testing.B) {
+	words := benchmarkWords(10000)
+	for _, fanout := range []int{0, 4, 26} {
+		b.Run(fmt.Sprintf("fanout %d", fanout), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				trie := NewTrieWithFanout[int](fanout)
+				for j, word := range words {
+					trie.Insert(word, j)
+				}
+			}
+		})
+	}
+}
+
+func TestTrieBusiestPrefix(t *testing.T) {
+	t.Run("dominant subtree", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, key := range []string{"apple", "banana", "car", "cart", "carton", "cat", "dog", "dot"} {
+			trie.Insert(key, 0)
+		}
+		prefix, completions := trie.BusiestPrefix()
+		assert.Equal(t, "c", prefix)
+		assert.Equal(t, 4, completions)
+	})
+	t.Run("ties", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, key := range []string{"bx", "by", "ax", "ay"} {
+			trie.Insert(key, 0)
+		}
+		prefix, completions := trie.BusiestPrefix()
+		assert.Equal(t, "a", prefix)
+		assert.Equal(t, 2, completions)
+	})
+	t.Run("only the empty key", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("", 0)
+		prefix, completions := trie.BusiestPrefix()
+		assert.Equal(t, "", prefix)
+		assert.Equal(t, 0, completions)
+	})
+}
+
+func TestTrieLongestSharedPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		trie   *Trie[int]
+		prefix string
+		count  int
+	}{
+		{"deepest shared prefix", newTrieOfKeys("caalcu", "caalcr"), "caalc", 2},
+		{"fixture", func() *Trie[int] {
+			trie := newTrieOfKeys()
+			for _, key := range newFixtureTrie().GetAll() {
+				trie.Insert(key, 0)
+			}
+			return trie
+		}(), "caalc", 3},
+		{"keys diverge early", newTrieOfKeys("apple", "banana", "bat"), "ba", 2},
+		{"keys diverge at the root", newTrieOfKeys("a", "b", "c"), "", 3},
+		{"key prefixing another", newTrieOfKeys("car", "cart", "dog"), "car", 2},
+		{"ties go to more keys", newTrieOfKeys("abx", "aby", "acx", "acy", "acz"), "ac", 3},
+		{"ties go to the smallest", newTrieOfKeys("abx", "aby", "acx", "acy"), "ab", 2},
+		{"single key", newTrieOfKeys("cat"), "", 0},
+		{"empty", newTrieOfKeys(), "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, count := tt.trie.LongestSharedPrefix()
+			assert.Equal(t, tt.prefix, prefix)
+			assert.Equal(t, tt.count, count)
+		})
+	}
+}
+
+func TestTrieMergeableChains(t *testing.T) {
+	trie := NewTrie[int]()
+	for _, key := range []string{"team", "tea", "ten", "toast", "to"} {
+		trie.Insert(key, 0)
+	}
+	// "toa" and "toas" lead only to "toast"
+	assert.Equal(t, []string{"toa"}, trie.MergeableChains())
+
+	// without "ten", "te" only leads on to "tea"
+	trie.Delete("ten")
+	assert.Equal(t, []string{"te", "toa"}, trie.MergeableChains())
+	// without "to", the chain below it grows to start at "to"
+	trie.Delete("to")
+	assert.Equal(t, []string{"te", "to"}, trie.MergeableChains())
+
+	chains, _ := trie.CompressionPotential()
+	assert.Equal(t, 4, chains)
+	assert.Equal(t, []string{}, NewTrie[int]().MergeableChains())
+}
+
+func TestTrieNextRunes(t *testing.T) {
+	trie := NewTrie[int]()
+	for _, key := range []string{"cat", "car", "cab", "café", "co", "dog"} {
+		trie.Insert(key, 0)
+	}
+	tests := []struct {
+		prefix string
+		want   []rune
+	}{
+		{"", []rune{'c', 'd'}},
+		{"c", []rune{'a', 'o'}},
+		{"ca", []rune{'b', 'f', 'r', 't'}},
+		{"caf", []rune{'é'}},
+		{"cat", []rune{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got, ok := trie.NextRunes(tt.prefix)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, slices.IsSorted(got))
+		})
+	}
+	t.Run("missing prefix", func(t *testing.T) {
+		_, ok := trie.NextRunes("cow")
+		assert.False(t, ok)
+	})
+}
+
+func TestTrieFingerprint(t *testing.T) {
+	valueHash := func(v int) uint64 { return uint64(v) }
+	build := func(keys ...string) *Trie[int] {
+		trie := NewTrie[int]()
+		for _, key := range keys {
+			trie.Insert(key, len(key))
+		}
+		return trie
+	}
+
+	t.Run("independent of insertion order", func(t *testing.T) {
+		a := build("", "car", "cart", "cat", "日本")
+		b := build("日本", "cat", "cart", "", "car")
+		assert.Equal(t, a.Fingerprint(valueHash), b.Fingerprint(valueHash))
+
+		// deleting and reinserting leaves the same content
+		b.Delete("cart")
+		b.Insert("cart", 4)
+		assert.Equal(t, a.Fingerprint(valueHash), b.Fingerprint(valueHash))
+	})
+	t.Run("distinct content", func(t *testing.T) {
+		fingerprints := map[uint64]string{}
+		for name, trie := range map[string]*Trie[int]{
+			"empty":         build(),
+			"empty key":     build(""),
+			"ab c":          build("ab", "c"),
+			"a bc":          build("a", "bc"),
+			"abc":           build("abc"),
+			"car cat":       build("car", "cat"),
+			"car cat cart":  build("car", "cat", "cart"),
+			"changed value": func() *Trie[int] { trie := build("car", "cat"); trie.SetValue("cat", 0); return trie }(),
+		} {
+			fingerprint := trie.Fingerprint(valueHash)
+			assert.NotContains(t, fingerprints, fingerprint, "%s collides with %s", name, fingerprints[fingerprint])
+			fingerprints[fingerprint] = name
+		}
+	})
+}
+
+func TestTrieStoredKeys(t *testing.T) {
+	// checkStoredKeys asserts every end node holds the key rebuilt from its path
+	checkStoredKeys := func(t *testing.T, trie *Trie[int]) {
+		t.Helper()
+		walk(trie.Root, []rune{}, func(key string, node *Node[int]) error {
+			if node.IsEnd {
+				assert.Equal(t, key, node.key)
+			}
+			return nil
+		})
+	}
+	trie := NewTrieStoringKeys[int]()
+	for i, key := range []string{"car", "cart", "café", "dog", ""} {
+		trie.Insert(key, i)
+	}
+	trie.InsertRunes([]rune("日本"), 5)
+	checkStoredKeys(t, trie)
+	assert.Equal(t, []string{"", "café", "car", "cart", "dog", "日本"}, trie.GetAll())
+
+	t.Run("across operations", func(t *testing.T) {
+		assert.Nil(t, trie.Rename("dog", "cat"))
+		trie.Delete("car")
+		trie.Insert("car", 6)
+		trie.SoftDelete("cart")
+		trie.Undelete("cart")
+		checkStoredKeys(t, trie)
+		want := []string{"", "café", "car", "cart", "cat", "日本"}
+		assert.Equal(t, want, trie.GetAll())
+		walked := []string{}
+		trie.Walk(func(key string, value int) error {
+			walked = append(walked, key)
+			return nil
+		})
+		assert.Equal(t, want, walked)
+	})
+	t.Run("sub tries", func(t *testing.T) {
+		sub, err := trie.SubTrie("ca", false)
+		assert.Nil(t, err)
+		checkStoredKeys(t, sub)
+		assert.Equal(t, []string{"fé", "r", "rt", "t"}, sub.GetAll())
+		sub, _ = trie.SubTrie("ca", true)
+		checkStoredKeys(t, sub)
+	})
+	t.Run("normalized keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithStoredKeys[int](), WithKeyNormalizer[int](strings.ToLower))
+		trie.Insert("CaT", 1)
+		checkStoredKeys(t, trie)
+		assert.Equal(t, []string{"cat"}, trie.GetAll())
+	})
+	t.Run("keys are not stored by default", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("cat", 1)
+		node, _ := trie.NodeAt("cat")
+		assert.Equal(t, "", node.key)
+	})
+}
+
+func BenchmarkStoredKeys(b *testing.B) {
+	words := benchmarkWords(10000)
+	for name, trie := range map[string]*Trie[int]{"rebuilt": NewTrie[int](), "stored": NewTrieStoringKeys[int]()} {
+		for j, word := range words {
+			trie.Insert(word, j)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				trie.GetAll()
+			}
+		})
+	}
+}
+
+func TestTrieBranchFactor(t *testing.T) {
+	trie := NewTrie[int]()
+	for _, key := range []string{"cat", "car", "cab", "dog", "dot", "zebra"} {
+		trie.Insert(key, 0)
+	}
+	tests := []struct {
+		prefix string
+		want   int
+	}{
+		{"", 3},
+		{"c", 1},
+		{"ca", 3},
+		{"do", 2},
+		{"zeb", 1},
+		{"cat", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got, ok := trie.BranchFactor(tt.prefix)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	t.Run("missing prefix", func(t *testing.T) {
+		_, ok := trie.BranchFactor("cow")
+		assert.False(t, ok)
+	})
+}
+
+func TestTrieToNestedMap(t *testing.T) {
+	trie := NewTrie[int]()
+	trie.Insert("ca", 1)
+	trie.Insert("cat", 2)
+	trie.Insert("co", 3)
+	trie.Insert("$", 4)
+	want := map[string]any{
+		"$": map[string]any{"$value": 4},
+		"c": map[string]any{
+			"a": map[string]any{
+				"$value": 1,
+				"t":      map[string]any{"$value": 2},
+			},
+			"o": map[string]any{"$value": 3},
+		},
+	}
+	assert.Equal(t, want, trie.ToNestedMap())
+
+	trie.Insert("", 0)
+	assert.Equal(t, 0, trie.ToNestedMap()[NestedMapValueKey])
+	assert.Equal(t, map[string]any{}, NewTrie[int]().ToNestedMap())
+}
+
+func TestTrieInsertReport(t *testing.T) {
+	trie := NewTrie[int]()
+	tests := []struct {
+		key       string
+		shared    int
+		new       int
+		wantError error
+	}{
+		{"cart", 0, 4, nil},
+		{"car", 3, 0, nil},
+		{"cat", 2, 1, nil},
+		{"cartoon", 4, 3, nil},
+		{"dog", 0, 3, nil},
+		{"café", 2, 2, nil},
+		{"", 0, 0, nil},
+		{"cat", 3, 0, ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		shared, created, err := trie.InsertReport(tt.key, 0)
+		assert.Equal(t, tt.shared, shared, tt.key)
+		assert.Equal(t, tt.new, created, tt.key)
+		if tt.wantError != nil {
+			assert.ErrorIs(t, err, tt.wantError)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+	assert.Equal(t, trie.NodeCount(), trie.nodes)
+
+	t.Run("rejected keys", func(t *testing.T) {
+		trie := NewTrieWithOptions(WithMaxNodes[int](2))
+		shared, created, err := trie.InsertReport("abc", 0)
+		assert.ErrorIs(t, err, ErrTrieFull)
+		assert.Equal(t, 0, shared)
+		assert.Equal(t, 0, created)
+	})
+}
+
+func TestTriePartitions(t *testing.T) {
+	trie := newFixtureTrie()
+	trie.Insert("", "empty")
+	trie.Insert("日本", "japan")
+
+	partitions := trie.Partitions()
+	prefixes := []string{}
+	keys := []string{}
+	for _, partition := range partitions {
+		prefixes = append(prefixes, partition.Prefix)
+		for _, key := range partition.Sub.GetAll() {
+			keys = append(keys, partition.Prefix+key)
+		}
+	}
+	assert.Equal(t, []string{"", "a", "c", "日"}, prefixes)
+	assert.Equal(t, trie.GetAll(), keys)
+
+	t.Run("partitions are independent", func(t *testing.T) {
+		sub := partitions[3].Sub
+		got, err := sub.Search("本")
+		assert.Nil(t, err)
+		assert.Equal(t, "japan", got)
+		sub.Delete("本")
+		assert.True(t, trie.Contains("日本"))
+		partitions[0].Sub.Delete("")
+		assert.True(t, trie.Contains(""))
+	})
+	t.Run("empty trie", func(t *testing.T) {
+		assert.Equal(t, []Partition[int]{}, NewTrie[int]().Partitions())
+	})
+}
+
+func TestTrieEquivalentSuffixGroups(t *testing.T) {
+	build := func(keys ...string) *Trie[int] {
+		trie := NewTrie[int]()
+		for i, key := range keys {
+			trie.Insert(key, i)
+		}
+		return trie
+	}
+	// the leaves "s", then "rs", "ars" and the subtrees below "c" and "b"
+	assert.Equal(t, 4, build("cars", "bars").EquivalentSuffixGroups())
+	// "tars" shares "ars" but not the level above it, as "t" also leads to "ar"
+	assert.Equal(t, 4, build("cars", "bars", "tars", "tar").EquivalentSuffixGroups())
+	// one group per level of "alking" below "w" and "t", which "jumping" joins for "ing" without adding any
+	assert.Equal(t, 7, build("walking", "talking", "jumping").EquivalentSuffixGroups())
+	assert.Equal(t, 0, build("cat").EquivalentSuffixGroups())
+	assert.Equal(t, 0, NewTrie[int]().EquivalentSuffixGroups())
+}
+
+func TestTrieMinimize(t *testing.T) {
+	words := []string{"cars", "bars", "tars", "car", "bar", "walking", "talking", "jumping", "jump"}
+	equal := func(a, b int) bool { return a == b }
+
+	t.Run("shared suffixes", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, word := range words {
+			trie.Insert(word, 0)
+		}
+		want := trie.GetAll()
+		nodes := trie.NodeCount()
+
+		// "ars" below "c" merges with the one below "b", which "tars" shares the "s" of,
+		// then "lking" below "wa" and "ta", and "ing" below "jump"
+		removed := trie.Minimize(equal)
+		assert.Equal(t, 3+1+5+3, removed)
+		assert.Equal(t, nodes-removed, trie.nodes)
+		assert.Equal(t, want, trie.GetAll())
+		for _, word := range words {
+			assert.True(t, trie.Contains(word), word)
+		}
+		assert.False(t, trie.Contains("tar"))
+		assert.Nil(t, trie.Validate())
+
+		c, _ := trie.NodeAt("c")
+		b, _ := trie.NodeAt("b")
+		assert.Same(t, c.Children[0], b.Children[0])
+	})
+	t.Run("different values are kept apart", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for i, word := range words {
+			trie.Insert(word, i)
+		}
+		// every subtree holds a key with a value of its own
+		assert.Equal(t, 0, trie.Minimize(equal))
+
+		trie = NewTrie[int]()
+		for _, word := range words {
+			trie.Insert(word, len(word))
+		}
+		// words sharing a suffix have the same length here, so they merge as before
+		assert.Equal(t, 12, trie.Minimize(equal))
+		for _, word := range words {
+			got, err := trie.Search(word)
+			assert.Nil(t, err)
+			assert.Equal(t, len(word), got)
+		}
+	})
+	t.Run("sub tries copy shared nodes apart", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, word := range words {
+			trie.Insert(word, 0)
+		}
+		trie.Minimize(equal)
+		sub, _ := trie.SubTrie("", true)
+		sub.Insert("carts", 0)
+		assert.True(t, sub.Contains("carts"))
+		assert.False(t, sub.Contains("barts"))
+		assert.False(t, trie.Contains("carts"))
+
+		// the copy no longer shares nodes, so has as many as sub before it got "t" and "s"
+		clone := trie.Clone()
+		assert.Equal(t, sub.NodeCount()-2, clone.NodeCount())
+		assert.Nil(t, clone.Insert("carts", 0))
+		assert.False(t, trie.Contains("carts"))
+	})
+	t.Run("minimizing again removes nothing", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, word := range words {
+			trie.Insert(word, 0)
+		}
+		removed := trie.Minimize(equal)
+		nodes := trie.NodeCount()
+		assert.Equal(t, 0, trie.Minimize(equal))
+		assert.Equal(t, nodes, trie.NodeCount())
+		assert.Greater(t, removed, 0)
+	})
+	t.Run("read-only", func(t *testing.T) {
+		trie := NewTrie[int]()
+		for _, word := range words {
+			trie.Insert(word, 0)
+		}
+		trie.Minimize(equal)
+		want := trie.GetAll()
+
+		assert.ErrorIs(t, trie.Insert("carts", 0), ErrMinimized)
+		assert.ErrorIs(t, trie.InsertRunes([]rune("carts"), 0), ErrMinimized)
+		assert.ErrorIs(t, trie.SetValue("cars", 1), ErrMinimized)
+		_, err := trie.Delete("cars")
+		assert.ErrorIs(t, err, ErrMinimized)
+		_, err = trie.Increment("bars", 1, func(a, b int) int { return a + b })
+		assert.ErrorIs(t, err, ErrMinimized)
+		assert.ErrorIs(t, trie.SoftDelete("cars"), ErrMinimized)
+		assert.False(t, trie.CompareAndSwap("cars", 0, 1, equal))
+		assert.Equal(t, 0, trie.DeleteIf(func(string, int) bool { return true }))
+		_, ok := trie.Sequence("cars")
+		assert.False(t, ok)
+
+		assert.Equal(t, want, trie.GetAll())
+		got, _ := trie.Search("bars")
+		assert.Equal(t, 0, got)
+
+		trie.Clear()
+		assert.Nil(t, trie.Insert("carts", 0))
+	})
+	t.Run("stored keys are kept apart", func(t *testing.T) {
+		trie := NewTrieStoringKeys[int]()
+		trie.Insert("cars", 0)
+		trie.Insert("bars", 0)
+		// the "s" nodes hold different keys, so the subtrees above them differ too
+		assert.Equal(t, 0, trie.Minimize(equal))
+		assert.Equal(t, []string{"bars", "cars"}, trie.GetAll())
+	})
+	t.Run("soft deleted keys are kept apart", func(t *testing.T) {
+		trie := NewTrie[int]()
+		trie.Insert("cars", 0)
+		trie.Insert("bars", 0)
+		trie.Insert("bar", 0)
+		trie.Insert("car", 0)
+		trie.SoftDelete("car")
+		assert.Equal(t, 1, trie.Minimize(equal))
+		assert.Equal(t, []string{"bar", "bars", "cars"}, trie.GetAll())
+	})
+}
+
+func TestTrieSkipRunes(t *testing.T) {
+	trie := NewTrieWithOptions(WithSkipRunes[int]('-', ' '))
+	assert.Nil(t, trie.Insert("cooperate", 1))
+	assert.Nil(t, trie.Insert("co-ordinate", 2))
+
+	t.Run("search", func(t *testing.T) {
+		for _, key := range []string{"co-operate", "co operate", "cooperate", "-cooperate-"} {
+			got, err := trie.Search(key)
+			assert.Nil(t, err, key)
+			assert.Equal(t, 1, got)
+		}
+		got, err := trie.SearchRunes([]rune("coordinate"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, got)
+		_, err = trie.Search("co_operate")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("keys are stored without skipped runes", func(t *testing.T) {
+		assert.Equal(t, []string{"cooperate", "coordinate"}, trie.GetAll())
+		assert.ErrorIs(t, trie.Insert("co-op-erate", 3), ErrAlreadyExists)
+		assert.Equal(t, []string{"cooperate"}, trie.PrefixSearch("co-op"))
+	})
+	t.Run("runes given by the caller are left alone", func(t *testing.T) {
+		key := []rune("co-operate")
+		trie.SearchRunes(key)
+		assert.Equal(t, "co-operate", string(key))
+	})
+	t.Run("prefixes and queries", func(t *testing.T) {
+		assert.Equal(t, []Entry[int]{{Key: "cooperate", Value: 1}}, trie.AutoComplete("co-op"))
+		assert.Equal(t, []string{"cooperate"}, trie.SuggestN("co op", 1))
+		_, ok := trie.NodeAt("co-op")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"cooperate"}, trie.PrefixesOf("co-operate-ly"))
+		assert.Equal(t, []Entry[int]{{Key: "cooperate", Value: 1}}, trie.Ancestors("co-operate-ly"))
+		page, _, err := trie.PrefixSearchPage("co-o", 5, "co-op")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"cooperate", "coordinate"}, page)
+		assert.Equal(t, []string{"coordinate"}, trie.KeysInRange("co-or", "co-p"))
+		best, ok := trie.BestCompletion("co-op", func(a, b string) bool { return a < b })
+		assert.True(t, ok)
+		assert.Equal(t, "cooperate", best)
+		sub, err := trie.SubTrie("co-op", false)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"erate"}, sub.GetAll())
+		walked := []string{}
+		assert.Nil(t, trie.WalkPrefix("co-op", func(key string, value int) error {
+			walked = append(walked, key)
+			return nil
+		}))
+		assert.Equal(t, []string{"cooperate"}, walked)
+		from := []string{}
+		for key := range trie.IterFrom("co-or") {
+			from = append(from, key)
+		}
+		assert.Equal(t, []string{"coordinate"}, from)
+		assert.Equal(t, []string{"cooperate"}, trie.FuzzySearch("co-operat", 1))
+		assert.Equal(t, []string{"cooperate"}, trie.SuffixSearch("r-ate"))
+	})
+	t.Run("patterns", func(t *testing.T) {
+		got, err := trie.GlobSearch("co-op*")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"cooperate"}, got)
+		assert.Equal(t, []string{"cooperate"}, trie.ClassSearch(`co-op\wr\w\w\w`))
+	})
+	t.Run("delete", func(t *testing.T) {
+		got, err := trie.Delete("co ordinate")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, got)
+		assert.False(t, trie.Contains("coordinate"))
+	})
+}
+
+func TestCollectAll(t *testing.T) {
+	type word struct {
+		text   string
+		length int
+		rank   int
+	}
+	trie := NewTrie[int]()
+	for i, key := range []string{"cat", "", "café", "car"} {
+		trie.Insert(key, i)
+	}
+	got := CollectAll(trie, func(key string, value int) word {
+		return word{text: key, length: utf8.RuneCountInString(key), rank: value}
+	})
+	assert.Equal(t, []word{{"", 0, 1}, {"café", 4, 2}, {"car", 3, 3}, {"cat", 3, 0}}, got)
+	assert.Equal(t, trie.GetAll(), CollectAll(trie, func(key string, value int) string { return key }))
+	assert.Equal(t, []int{}, CollectAll(NewTrie[int](), func(key string, value int) int { return value }))
+}
+
+func TestTrieChangeCountSince(t *testing.T) {
+	equal := func(a, b string) bool { return a == b }
+	baseline := newFixtureTrie()
+	baseline.Insert("", "empty")
+
+	t.Run("no changes", func(t *testing.T) {
+		clone, _ := baseline.SubTrie("", true)
+		assert.Equal(t, 0, clone.ChangeCountSince(baseline, equal))
+	})
+	t.Run("known edits", func(t *testing.T) {
+		clone, _ := baseline.SubTrie("", true)
+		clone.Insert("dog", "new")
+		clone.Insert("doge", "new")
+		clone.Delete("as")
+		clone.Delete("")
+		clone.SetValue("ask", "changed")
+		assert.Equal(t, 5, clone.ChangeCountSince(baseline, equal))
+		added, removed, changed := baseline.Diff(clone, equal)
+		assert.Equal(t, len(added)+len(removed)+len(changed), clone.ChangeCountSince(baseline, equal))
+		assert.Equal(t, 5, baseline.ChangeCountSince(clone, equal))
+	})
+	t.Run("against an empty trie", func(t *testing.T) {
+		assert.Equal(t, baseline.Len(), NewTrie[string]().ChangeCountSince(baseline, equal))
+	})
+}
+
+func TestFoldKeys(t *testing.T) {
+	trie := NewTrie[int]()
+	for key, value := range map[string]int{"": 5, "a": 1, "ab": 2, "café": 3} {
+		trie.Insert(key, value)
+	}
+	weighted := FoldKeys(trie, 0, func(acc int, key string, value int, depth int) int {
+		return acc + value*depth
+	})
+	assert.Equal(t, 5*0+1*1+2*2+3*4, weighted)
+
+	type visit struct {
+		key   string
+		depth int
+	}
+	visits := FoldKeys(trie, []visit{}, func(acc []visit, key string, value int, depth int) []visit {
+		return append(acc, visit{key, depth})
+	})
+	assert.Equal(t, []visit{{"", 0}, {"a", 1}, {"ab", 2}, {"café", 4}}, visits)
+	assert.Equal(t, 0, FoldKeys(NewTrie[int](), 0, func(acc int, key string, value int, depth int) int { return acc + 1 }))
 }
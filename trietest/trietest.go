@@ -0,0 +1,38 @@
+// Package trietest provides helpers for tests of code using tries,
+// kept apart so the trie package doesn't import testing.
+package trietest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/benkalmus/trie"
+)
+
+// AssertTrieEqual marks the test failed unless want and got hold the same keys with values equal according to eq.
+// The failure lists the keys added in got as +, those missing from got as -, and those with changed values as ~,
+// each in lexicographic order. It reports whether the tries are equal.
+func AssertTrieEqual[T any](t testing.TB, want, got *trie.Trie[T], eq func(a, b T) bool) bool {
+	t.Helper()
+	added, removed, changed := want.Diff(got, eq)
+	if len(added)+len(removed)+len(changed) == 0 {
+		return true
+	}
+	var diff strings.Builder
+	for _, key := range added {
+		value, _ := got.Search(key)
+		fmt.Fprintf(&diff, "\n+ %q: %v", key, value)
+	}
+	for _, key := range removed {
+		value, _ := want.Search(key)
+		fmt.Fprintf(&diff, "\n- %q: %v", key, value)
+	}
+	for _, key := range changed {
+		wantValue, _ := want.Search(key)
+		gotValue, _ := got.Search(key)
+		fmt.Fprintf(&diff, "\n~ %q: %v -> %v", key, wantValue, gotValue)
+	}
+	t.Errorf("tries differ:%s", diff.String())
+	return false
+}
@@ -0,0 +1,61 @@
+package trietest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/benkalmus/trie"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder captures the failures of a test instead of failing it
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func newTrie(m map[string]int) *trie.Trie[int] {
+	t, _ := trie.NewTrieFromMap(m)
+	return t
+}
+
+func equal(a, b int) bool {
+	return a == b
+}
+
+func TestAssertTrieEqual(t *testing.T) {
+	t.Run("equal tries", func(t *testing.T) {
+		r := &recorder{TB: t}
+		want := newTrie(map[string]int{"": 0, "car": 1, "cat": 2})
+		got := newTrie(map[string]int{"cat": 2, "car": 1, "": 0})
+		assert.True(t, AssertTrieEqual(r, want, got, equal))
+		assert.True(t, AssertTrieEqual(r, trie.NewTrie[int](), trie.NewTrie[int](), equal))
+		assert.Empty(t, r.errors)
+	})
+	t.Run("different tries", func(t *testing.T) {
+		r := &recorder{TB: t}
+		want := newTrie(map[string]int{"car": 1, "cat": 2, "dog": 3, "cow": 4})
+		got := newTrie(map[string]int{"car": 1, "cat": 5, "cart": 6, "ant": 7, "cow": 8})
+		assert.False(t, AssertTrieEqual(r, want, got, equal))
+		assert.Equal(t, []string{`tries differ:
++ "ant": 7
++ "cart": 6
+- "dog": 3
+~ "cat": 2 -> 5
+~ "cow": 4 -> 8`}, r.errors)
+	})
+	t.Run("custom equality", func(t *testing.T) {
+		r := &recorder{TB: t}
+		want := newTrie(map[string]int{"a": 1, "b": 2})
+		got := newTrie(map[string]int{"a": 3, "b": 4})
+		sameParity := func(a, b int) bool { return a%2 == b%2 }
+		assert.True(t, AssertTrieEqual(r, want, got, sameParity))
+		assert.Empty(t, r.errors)
+	})
+}